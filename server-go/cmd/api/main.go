@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"github.com/joho/godotenv"
 
+	"github.com/your-org/notes-api/internal/auth"
 	"github.com/your-org/notes-api/internal/config"
 	"github.com/your-org/notes-api/internal/db"
 	"github.com/your-org/notes-api/internal/http/router"
+	"github.com/your-org/notes-api/internal/mailer"
+	"github.com/your-org/notes-api/internal/password"
+	"github.com/your-org/notes-api/internal/trash"
 )
 
 func main() {
@@ -22,7 +27,31 @@ func main() {
 		log.Fatalf("failed to init db: %v", err)
 	}
 
-	r := router.New(cfg, gormDB)
+	keys, err := auth.LoadKeySet(cfg)
+	if err != nil {
+		log.Fatalf("failed to load jwt keys: %v", err)
+	}
+
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to init mailer: %v", err)
+	}
+
+	passwords, err := password.NewHasher(cfg)
+	if err != nil {
+		log.Fatalf("failed to init password hasher: %v", err)
+	}
+	policy, err := password.LoadPolicy(cfg)
+	if err != nil {
+		log.Fatalf("failed to load password policy: %v", err)
+	}
+
+	go trash.NewPurger(cfg, gormDB).Run(context.Background())
+
+	r, err := router.New(cfg, gormDB, keys, mail, passwords, policy)
+	if err != nil {
+		log.Fatalf("failed to init router: %v", err)
+	}
 
 	addr := ":" + cfg.AppPort
 	if v := os.Getenv("PORT"); v != "" {
@@ -0,0 +1,38 @@
+// Command mockoidc is a stand-in OpenID Connect issuer for development. It
+// approves every authorization request without a login page, signing in as
+// MOCK_OIDC_EMAIL or as the address in the login_hint parameter, and it
+// enforces PKCE like a real issuer. Tests use the same issuer through
+// internal/oidc/oidctest.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/your-org/notes-api/internal/oidc/oidctest"
+)
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func main() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("generate key: %v", err)
+	}
+	iss := oidctest.NewIssuer(strings.TrimSuffix(getenv("MOCK_OIDC_ISSUER", "http://localhost:9000"), "/"), key)
+	iss.Name = getenv("MOCK_OIDC_NAME", "Dev User")
+	iss.Email = getenv("MOCK_OIDC_EMAIL", "dev@example.com")
+	iss.Verified = getenv("MOCK_OIDC_EMAIL_VERIFIED", "true") == "true"
+	addr := getenv("MOCK_OIDC_ADDR", ":9000")
+	log.Printf("mock OIDC issuer %s listening on %s", iss.URL, addr)
+	log.Fatal(http.ListenAndServe(addr, iss))
+}
@@ -0,0 +1,33 @@
+// Package audit records security-relevant events in the audit_logs table.
+package audit
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// Events.
+const (
+	// EventAccountLocked: too many failed logins locked an account.
+	EventAccountLocked = "login.account_locked"
+	// EventIPLocked: too many failed logins locked a client IP address.
+	EventIPLocked = "login.ip_locked"
+	// EventAccountDeleted: a user deleted their account.
+	EventAccountDeleted = "account.deleted"
+)
+
+// Record writes an audit entry. userID may be nil.
+func Record(db *gorm.DB, event string, userID *uuid.UUID, ip string, detail map[string]interface{}) error {
+	return db.Create(&models.AuditLog{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Event:     event,
+		IP:        ip,
+		Detail:    detail,
+		CreatedAt: time.Now().UTC(),
+	}).Error
+}
@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// AttemptState is the failed-login record of one account or IP address.
+type AttemptState struct {
+	Failures    int
+	LastFailure time.Time
+	// BlockedUntil holds off further attempts, for a backoff delay or, when
+	// Locked is set, for a lockout.
+	BlockedUntil time.Time
+	Locked       bool
+	// ExpiresAt is when the state stops mattering and may be dropped.
+	ExpiresAt time.Time
+}
+
+// AttemptStore keeps failed-login state by key.
+type AttemptStore interface {
+	// Get returns the state for key, or the zero state if there is none.
+	Get(key string) (AttemptState, error)
+	// Update replaces the state for key with fn's result, atomically with
+	// respect to other updates of the same key.
+	Update(key string, fn func(AttemptState) AttemptState) (AttemptState, error)
+	// Reset forgets key, and any other state that has expired.
+	Reset(key string) error
+}
+
+const (
+	// memoryAttemptsMax caps how many keys the memory store holds, so that
+	// failures spread over many emails or addresses cannot grow it without
+	// bound.
+	memoryAttemptsMax = 100000
+	// memorySweepEvery is how often an update also drops expired state.
+	memorySweepEvery = time.Minute
+)
+
+type memoryAttemptStore struct {
+	mu        sync.Mutex
+	states    map[string]AttemptState
+	max       int
+	nextSweep time.Time
+}
+
+// NewMemoryAttemptStore returns an AttemptStore for a single server instance.
+// State is lost on restart.
+func NewMemoryAttemptStore() AttemptStore {
+	return &memoryAttemptStore{states: map[string]AttemptState{}, max: memoryAttemptsMax}
+}
+
+func (s *memoryAttemptStore) Get(key string) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+// Update also sweeps expired state now and then. When the store is full a
+// new key evicts another; keys that are locked out are evicted last, so a
+// flood of new keys does not lift a lockout.
+func (s *memoryAttemptStore) Update(key string, fn func(AttemptState) AttemptState) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.After(s.nextSweep) {
+		s.sweep(now)
+	}
+	if _, ok := s.states[key]; !ok && len(s.states) >= s.max {
+		s.sweep(now)
+		if len(s.states) >= s.max {
+			s.evict(now)
+		}
+	}
+	st := fn(s.states[key])
+	s.states[key] = st
+	return st, nil
+}
+
+func (s *memoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	s.sweep(time.Now())
+	return nil
+}
+
+func (s *memoryAttemptStore) sweep(now time.Time) {
+	for k, st := range s.states {
+		if st.ExpiresAt.Before(now) {
+			delete(s.states, k)
+		}
+	}
+	s.nextSweep = now.Add(memorySweepEvery)
+}
+
+// evict drops one key, preferring one that is not locked out. Map iteration
+// order is random, so no key is predictably the one to go.
+func (s *memoryAttemptStore) evict(now time.Time) {
+	victim, found := "", false
+	for k, st := range s.states {
+		if !st.Locked || !st.BlockedUntil.After(now) {
+			delete(s.states, k)
+			return
+		}
+		if !found {
+			victim, found = k, true
+		}
+	}
+	if found {
+		delete(s.states, victim)
+	}
+}
+
+type dbAttemptStore struct {
+	db *gorm.DB
+}
+
+// NewDBAttemptStore returns an AttemptStore backed by the database, so every
+// server instance counts the same attempts.
+func NewDBAttemptStore(db *gorm.DB) AttemptStore {
+	return &dbAttemptStore{db: db}
+}
+
+func (s *dbAttemptStore) Get(key string) (AttemptState, error) {
+	var row models.LoginAttempt
+	err := s.db.Where("attempt_key = ?", key).Limit(1).Find(&row).Error
+	return attemptState(row), err
+}
+
+func (s *dbAttemptStore) Update(key string, fn func(AttemptState) AttemptState) (AttemptState, error) {
+	var st AttemptState
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginAttempt{Key: key, ExpiresAt: time.Now().UTC()}).Error; err != nil {
+			return err
+		}
+		var row models.LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("attempt_key = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+		st = fn(attemptState(row))
+		return tx.Model(&row).Updates(map[string]interface{}{
+			"failures":      st.Failures,
+			"last_failure":  nullTime(st.LastFailure),
+			"blocked_until": nullTime(st.BlockedUntil),
+			"locked":        st.Locked,
+			"expires_at":    st.ExpiresAt.UTC(),
+		}).Error
+	})
+	return st, err
+}
+
+func (s *dbAttemptStore) Reset(key string) error {
+	if err := s.db.Where("attempt_key = ?", key).Delete(&models.LoginAttempt{}).Error; err != nil {
+		return err
+	}
+	return s.db.Where("expires_at < ?", time.Now().UTC()).Delete(&models.LoginAttempt{}).Error
+}
+
+func attemptState(row models.LoginAttempt) AttemptState {
+	st := AttemptState{Failures: row.Failures, Locked: row.Locked, ExpiresAt: row.ExpiresAt}
+	if row.LastFailure != nil {
+		st.LastFailure = *row.LastFailure
+	}
+	if row.BlockedUntil != nil {
+		st.BlockedUntil = *row.BlockedUntil
+	}
+	return st
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// Throttle says whether login attempts are currently held off.
+type Throttle struct {
+	// RetryAfter is how long to wait; zero means attempts are allowed.
+	RetryAfter time.Duration
+	// Locked distinguishes a lockout from an exponential backoff delay.
+	Locked bool
+}
+
+// Blocked reports whether the attempt must be refused.
+func (t Throttle) Blocked() bool { return t.RetryAfter > 0 }
+
+func (t Throttle) max(o Throttle) Throttle {
+	if o.Locked != t.Locked {
+		if o.Locked {
+			return o
+		}
+		return t
+	}
+	if o.RetryAfter > t.RetryAfter {
+		return o
+	}
+	return t
+}
+
+// Failure is the outcome of recording a failed attempt.
+type Failure struct {
+	Throttle
+	// AccountLocked and IPLocked report a lockout that this failure started.
+	AccountLocked bool
+	IPLocked      bool
+}
+
+// LoginGuard limits password guessing. Failures are counted per account and
+// per client IP. After LoginFreeAttempts failures in a row, each further
+// failure on an account holds off its next attempt for an exponentially
+// growing delay. Reaching a lockout threshold blocks the account or IP for
+// LoginLockoutDuration. IPs get no backoff, since many users can share one
+// address, only a lockout at a much higher threshold. Failures older than
+// LoginAttemptWindow are forgotten.
+type LoginGuard struct {
+	store            AttemptStore
+	freeAttempts     int
+	backoffBase      time.Duration
+	backoffMax       time.Duration
+	accountThreshold int
+	ipThreshold      int
+	lockout          time.Duration
+	window           time.Duration
+}
+
+// NewLoginGuard returns a LoginGuard configured from cfg.
+func NewLoginGuard(cfg config.Config, store AttemptStore) *LoginGuard {
+	return &LoginGuard{
+		store:            store,
+		freeAttempts:     cfg.LoginFreeAttempts,
+		backoffBase:      cfg.LoginBackoffBase,
+		backoffMax:       cfg.LoginBackoffMax,
+		accountThreshold: cfg.LoginLockoutThreshold,
+		ipThreshold:      cfg.LoginIPLockoutThreshold,
+		lockout:          cfg.LoginLockoutDuration,
+		window:           cfg.LoginAttemptWindow,
+	}
+}
+
+func accountKey(email string) string { return "account:" + strings.ToLower(strings.TrimSpace(email)) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// Check reports whether an attempt for the account from ip must wait. Keys
+// do not depend on whether the account exists, so responses reveal nothing
+// about which emails are registered.
+func (g *LoginGuard) Check(email, ip string) (Throttle, error) {
+	now := time.Now()
+	acct, err := g.store.Get(accountKey(email))
+	if err != nil {
+		return Throttle{}, err
+	}
+	addr, err := g.store.Get(ipKey(ip))
+	if err != nil {
+		return Throttle{}, err
+	}
+	return throttle(acct, now).max(throttle(addr, now)), nil
+}
+
+func throttle(st AttemptState, now time.Time) Throttle {
+	if !st.BlockedUntil.After(now) {
+		return Throttle{}
+	}
+	// Round up to whole seconds so clients that wait RetryAfter are let
+	// through.
+	wait := (st.BlockedUntil.Sub(now) + time.Second - 1) / time.Second * time.Second
+	return Throttle{RetryAfter: wait, Locked: st.Locked}
+}
+
+// Fail records a failed attempt and returns the throttle it results in.
+func (g *LoginGuard) Fail(email, ip string) (Failure, error) {
+	now := time.Now()
+	acct, acctLocked, err := g.fail(accountKey(email), g.accountThreshold, true, now)
+	if err != nil {
+		return Failure{}, err
+	}
+	addr, ipLocked, err := g.fail(ipKey(ip), g.ipThreshold, false, now)
+	if err != nil {
+		return Failure{}, err
+	}
+	return Failure{
+		Throttle:      throttle(acct, now).max(throttle(addr, now)),
+		AccountLocked: acctLocked,
+		IPLocked:      ipLocked,
+	}, nil
+}
+
+func (g *LoginGuard) fail(key string, threshold int, backoff bool, now time.Time) (AttemptState, bool, error) {
+	var locked bool
+	st, err := g.store.Update(key, func(st AttemptState) AttemptState {
+		locked = false
+		if now.Sub(st.LastFailure) > g.window || (st.Locked && !st.BlockedUntil.After(now)) {
+			st = AttemptState{}
+		}
+		st.Failures++
+		st.LastFailure = now
+		switch {
+		case threshold > 0 && st.Failures >= threshold:
+			st.BlockedUntil = now.Add(g.lockout)
+			st.Locked = true
+			locked = true
+		case backoff && st.Failures > g.freeAttempts:
+			delay := g.backoffMax
+			if shift := st.Failures - g.freeAttempts - 1; shift < 32 && g.backoffBase<<shift < g.backoffMax {
+				delay = g.backoffBase << shift
+			}
+			st.BlockedUntil = now.Add(delay)
+		}
+		st.ExpiresAt = now.Add(g.window)
+		if st.BlockedUntil.After(st.ExpiresAt) {
+			st.ExpiresAt = st.BlockedUntil
+		}
+		return st
+	})
+	return st, locked, err
+}
+
+// Succeed clears the account's failures after a successful login. The IP's
+// failures stay, so an attacker cannot reset them by logging into an account
+// of their own.
+func (g *LoginGuard) Succeed(email string) error {
+	return g.store.Reset(accountKey(email))
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryAttemptStoreSweepsOnUpdate(t *testing.T) {
+	s := NewMemoryAttemptStore().(*memoryAttemptStore)
+	past := time.Now().Add(-time.Minute)
+	for i := 0; i < 10; i++ {
+		_, _ = s.Update("old"+strconv.Itoa(i), func(AttemptState) AttemptState { return AttemptState{Failures: 1, ExpiresAt: past} })
+	}
+	s.nextSweep = time.Time{}
+	_, _ = s.Update("new", func(AttemptState) AttemptState {
+		return AttemptState{Failures: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	})
+	if len(s.states) != 1 {
+		t.Errorf("store holds %d keys after a sweep, want 1", len(s.states))
+	}
+}
+
+func TestMemoryAttemptStoreIsCapped(t *testing.T) {
+	s := NewMemoryAttemptStore().(*memoryAttemptStore)
+	s.max = 5
+	later := time.Now().Add(time.Hour)
+	_, _ = s.Update("locked", func(AttemptState) AttemptState {
+		return AttemptState{Failures: 10, Locked: true, BlockedUntil: later, ExpiresAt: later}
+	})
+	for i := 0; i < 100; i++ {
+		_, _ = s.Update("spray"+strconv.Itoa(i), func(AttemptState) AttemptState { return AttemptState{Failures: 1, ExpiresAt: later} })
+		if len(s.states) > s.max {
+			t.Fatalf("store holds %d keys, cap is %d", len(s.states), s.max)
+		}
+	}
+	if st, _ := s.Get("locked"); !st.Locked {
+		t.Error("a flood of new keys evicted a lockout")
+	}
+}
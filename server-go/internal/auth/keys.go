@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/your-org/notes-api/internal/config"
+)
+
+// Key is one JWT key, identified by the kid header of the tokens it signs.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Verify is the HMAC secret or the public key. Sign is nil for keys that
+	// are only kept to verify tokens issued before a rotation.
+	Verify interface{}
+	Sign   interface{}
+}
+
+// KeySet signs access tokens with one key and verifies them against every
+// configured key, so keys can be rotated without logging anyone out.
+type KeySet struct {
+	signing  *Key
+	keys     map[string]*Key
+	issuer   string
+	audience string
+}
+
+// LoadKeySet builds the key set from config. With JWT_ALGORITHM=HS256 tokens
+// are signed with JWT_SECRET, which must be set and, outside APP_ENV=dev,
+// must not be the public default that anyone could forge tokens with. With
+// RS256 or EdDSA they are signed with the PEM private key in
+// JWT_SIGNING_KEY_FILE, and the public keys listed in JWT_VERIFY_KEYS as
+// kid=path pairs are accepted as well.
+func LoadKeySet(cfg config.Config) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*Key{}, issuer: cfg.JWTIssuer, audience: cfg.JWTAudience}
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		id := cfg.JWTSigningKeyID
+		if id == "" {
+			id = "hs256"
+		}
+		if cfg.JWTSecret == "" {
+			return nil, fmt.Errorf("JWT_SECRET is required with JWT_ALGORITHM=HS256")
+		}
+		if cfg.JWTSecret == config.DefaultJWTSecret && cfg.AppEnv != "dev" {
+			return nil, fmt.Errorf("JWT_SECRET is the public default %q; set a secret of your own, or use RS256 or EdDSA", config.DefaultJWTSecret)
+		}
+		secret := []byte(cfg.JWTSecret)
+		ks.signing = &Key{ID: id, Method: jwt.SigningMethodHS256, Verify: secret, Sign: secret}
+	case "RS256", "EdDSA":
+		pemBytes, err := os.ReadFile(cfg.JWTSigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read JWT signing key: %w", err)
+		}
+		k, err := parsePrivateKey(cfg.JWTAlgorithm, pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse JWT signing key: %w", err)
+		}
+		k.ID = cfg.JWTSigningKeyID
+		if k.ID == "" {
+			if k.ID, err = thumbprint(k.Verify); err != nil {
+				return nil, err
+			}
+		}
+		ks.signing = k
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", cfg.JWTAlgorithm)
+	}
+	ks.keys[ks.signing.ID] = ks.signing
+
+	for _, entry := range strings.Split(cfg.JWTVerifyKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, path, ok := strings.Cut(entry, "=")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("JWT_VERIFY_KEYS entry %q is not kid=path", entry)
+		}
+		if _, dup := ks.keys[id]; dup {
+			return nil, fmt.Errorf("duplicate JWT key id %q", id)
+		}
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read JWT verify key %q: %w", id, err)
+		}
+		k, err := parsePublicKey(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse JWT verify key %q: %w", id, err)
+		}
+		k.ID = id
+		ks.keys[id] = k
+	}
+	return ks, nil
+}
+
+func parsePrivateKey(alg string, pemBytes []byte) (*Key, error) {
+	if alg == "RS256" {
+		priv, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{Method: jwt.SigningMethodRS256, Verify: &priv.PublicKey, Sign: priv}, nil
+	}
+	priv, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := priv.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an Ed25519 key")
+	}
+	return &Key{Method: jwt.SigningMethodEdDSA, Verify: signer.Public(), Sign: signer}, nil
+}
+
+func parsePublicKey(pemBytes []byte) (*Key, error) {
+	if pub, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes); err == nil {
+		return &Key{Method: jwt.SigningMethodRS256, Verify: pub}, nil
+	}
+	pub, err := jwt.ParseEdPublicKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("not an RSA or Ed25519 public key")
+	}
+	return &Key{Method: jwt.SigningMethodEdDSA, Verify: pub}, nil
+}
+
+// thumbprint derives a stable key ID from a public key.
+func thumbprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// Sign sets the issuer and audience on claims and signs them with the
+// current signing key.
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	claims["iss"] = ks.issuer
+	claims["aud"] = ks.audience
+	t := jwt.NewWithClaims(ks.signing.Method, claims)
+	t.Header["kid"] = ks.signing.ID
+	return t.SignedString(ks.signing.Sign)
+}
+
+// Parse verifies a token against the key named by its kid header, using only
+// that key's algorithm, and checks its expiry, issuer and audience.
+func (ks *KeySet) Parse(tokenStr string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if t.Method.Alg() != k.Method.Alg() {
+			return nil, fmt.Errorf("key %q does not use %s", kid, t.Method.Alg())
+		}
+		return k.Verify, nil
+	},
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(ks.issuer),
+		jwt.WithAudience(ks.audience),
+	)
+	return claims, err
+}
+
+// JWKS returns the public keys as a JSON Web Key Set. HMAC secrets are never
+// published, so the set is empty when tokens are signed with HS256.
+func (ks *KeySet) JWKS() map[string]interface{} {
+	out := []map[string]string{}
+	for _, k := range ks.keys {
+		jwk := map[string]string{"kid": k.ID, "alg": k.Method.Alg(), "use": "sig"}
+		switch pub := k.Verify.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		out = append(out, jwk)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["kid"] < out[j]["kid"] })
+	return map[string]interface{}{"keys": out}
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/your-org/notes-api/internal/config"
+)
+
+func TestLoadKeySetHS256Secret(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		secret string
+		ok     bool
+	}{
+		{name: "empty secret", env: "dev", secret: ""},
+		{name: "default secret in production", env: "production", secret: config.DefaultJWTSecret},
+		{name: "default secret outside dev", env: "staging", secret: config.DefaultJWTSecret},
+		{name: "default secret in dev", env: "dev", secret: config.DefaultJWTSecret, ok: true},
+		{name: "own secret in production", env: "production", secret: "a-long-random-secret-of-our-own", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeySet(config.Config{AppEnv: tt.env, JWTAlgorithm: "HS256", JWTSecret: tt.secret})
+			if (err == nil) != tt.ok {
+				t.Errorf("LoadKeySet() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
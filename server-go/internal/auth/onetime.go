@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// One-time token purposes.
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeEmailChange       = "email_change"
+)
+
+// ErrOneTimeInvalid means a one-time token is unknown, used, expired or was
+// issued for another purpose.
+var ErrOneTimeInvalid = errors.New("auth: invalid one-time token")
+
+// IssueOneTime creates a single-use token for purpose and returns it raw.
+// Earlier unused tokens the user holds for the same purpose stop working, so
+// only the most recent email link is valid.
+func IssueOneTime(db *gorm.DB, userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	return IssueOneTimeData(db, userID, purpose, "", ttl)
+}
+
+// IssueOneTimeData is IssueOneTime for a token that carries data, which
+// ConsumeOneTime hands back in the token's Data field.
+func IssueOneTimeData(db *gorm.DB, userID uuid.UUID, purpose, data string, ttl time.Duration) (string, error) {
+	raw, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).Delete(&models.OneTimeToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at < ?", now).Delete(&models.OneTimeToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OneTimeToken{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: HashToken(raw),
+			Data:      data,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	return raw, err
+}
+
+// ConsumeOneTime marks a token used and returns it. Run it in the same
+// transaction as the action the token authorises, so a failed action leaves
+// the token usable.
+func ConsumeOneTime(tx *gorm.DB, raw, purpose string) (models.OneTimeToken, error) {
+	var t models.OneTimeToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ? AND purpose = ?", HashToken(raw), purpose).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return t, ErrOneTimeInvalid
+	}
+	if err != nil {
+		return t, err
+	}
+	now := time.Now().UTC()
+	if t.UsedAt != nil || now.After(t.ExpiresAt) {
+		return t, ErrOneTimeInvalid
+	}
+	t.UsedAt = &now
+	return t, tx.Model(&t).Update("used_at", now).Error
+}
@@ -0,0 +1,131 @@
+// Package auth issues and checks the credentials clients authenticate with.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/your-org/notes-api/internal/models"
+)
+
+var (
+	// ErrRefreshInvalid means the refresh token is unknown, revoked or expired.
+	ErrRefreshInvalid = errors.New("auth: invalid refresh token")
+	// ErrRefreshReused means an already rotated refresh token was presented.
+	// Its whole family has been revoked by the time this is returned.
+	ErrRefreshReused = errors.New("auth: refresh token reused")
+)
+
+// HashToken returns the hex SHA-256 of an opaque token, the form in which
+// tokens are stored.
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewOpaqueToken returns a random URL-safe token with 256 bits of entropy.
+func NewOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IssueRefresh starts a new token family for a login and returns the raw
+// refresh token.
+func IssueRefresh(db *gorm.DB, userID uuid.UUID, deviceID string, ttl time.Duration) (string, models.RefreshToken, error) {
+	now := time.Now().UTC()
+	return issue(db, userID, uuid.New(), deviceID, &now, ttl)
+}
+
+func issue(db *gorm.DB, userID, familyID uuid.UUID, deviceID string, authTime *time.Time, ttl time.Duration) (string, models.RefreshToken, error) {
+	raw, err := NewOpaqueToken()
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+	rt := models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(raw),
+		DeviceID:  deviceID,
+		AuthTime:  authTime,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}
+	if err := db.Create(&rt).Error; err != nil {
+		return "", rt, err
+	}
+	return raw, rt, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same family. A token
+// that was already rotated revokes the family and yields ErrRefreshReused;
+// the revocation is committed even though an error is returned. issued is
+// called with the new row before the rotation commits, to sign the access
+// token that goes with it; if it fails the old refresh token stays valid.
+func Rotate(db *gorm.DB, raw string, ttl time.Duration, issued func(tx *gorm.DB, next models.RefreshToken) error) (string, models.RefreshToken, error) {
+	var (
+		next    string
+		nextRow models.RefreshToken
+		reused  bool
+	)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var rt models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", HashToken(raw)).First(&rt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshInvalid
+			}
+			return err
+		}
+		now := time.Now().UTC()
+		if rt.RevokedAt != nil {
+			return ErrRefreshInvalid
+		}
+		if rt.RotatedAt != nil {
+			reused = true
+			return RevokeFamily(tx, rt.FamilyID)
+		}
+		if now.After(rt.ExpiresAt) {
+			return ErrRefreshInvalid
+		}
+		if err := tx.Model(&rt).Update("rotated_at", now).Error; err != nil {
+			return err
+		}
+		var err error
+		next, nextRow, err = issue(tx, rt.UserID, rt.FamilyID, rt.DeviceID, rt.AuthTime, ttl)
+		if err != nil {
+			return err
+		}
+		if err := issued(tx, nextRow); err != nil {
+			return err
+		}
+		// Rotated rows are kept until they expire so that reuse is detected.
+		return tx.Where("user_id = ? AND expires_at < ?", rt.UserID, now).Delete(&models.RefreshToken{}).Error
+	})
+	if err != nil {
+		return "", nextRow, err
+	}
+	if reused {
+		return "", nextRow, ErrRefreshReused
+	}
+	return next, nextRow, nil
+}
+
+// RevokeFamily revokes every token descended from the same login.
+func RevokeFamily(db *gorm.DB, familyID uuid.UUID) error {
+	return db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", time.Now().UTC()).Error
+}
+
+// RevokeDevice revokes every refresh token issued to one of a user's devices.
+func RevokeDevice(db *gorm.DB, userID uuid.UUID, deviceID string) error {
+	return db.Model(&models.RefreshToken{}).Where("user_id = ? AND device_id = ? AND revoked_at IS NULL", userID, deviceID).Update("revoked_at", time.Now().UTC()).Error
+}
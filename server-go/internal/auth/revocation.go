@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// RevocationStore records access tokens that were revoked before they
+// expired. Single tokens are revoked by their jti claim. All of a user's
+// tokens are revoked at once by bumping the user's token generation: tokens
+// carry the generation they were issued under in their gen claim, and any
+// older generation is rejected.
+type RevocationStore interface {
+	// Revoke rejects the token with this jti until it would have expired.
+	Revoke(userID uuid.UUID, jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
+	// Generation returns the user's current token generation, or
+	// gorm.ErrRecordNotFound if the user no longer exists.
+	Generation(userID uuid.UUID) (int64, error)
+	// RevokeAll invalidates every access and refresh token the user holds
+	// and returns the new generation.
+	RevokeAll(userID uuid.UUID) (int64, error)
+}
+
+type dbRevocationStore struct {
+	db *gorm.DB
+}
+
+// NewRevocationStore returns a RevocationStore backed by the database, so
+// revocations are shared by every server instance.
+func NewRevocationStore(db *gorm.DB) RevocationStore {
+	return &dbRevocationStore{db: db}
+}
+
+func (s *dbRevocationStore) Revoke(userID uuid.UUID, jti string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	if !expiresAt.After(now) {
+		return nil
+	}
+	rt := models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rt).Error; err != nil {
+		return err
+	}
+	// Expired tokens are rejected anyway, so their entries can go.
+	return s.db.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error
+}
+
+func (s *dbRevocationStore) IsRevoked(jti string) (bool, error) {
+	var n int64
+	err := s.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&n).Error
+	return n > 0, err
+}
+
+func (s *dbRevocationStore) Generation(userID uuid.UUID) (int64, error) {
+	var u models.User
+	if err := s.db.Select("token_generation").Where("id = ?", userID).First(&u).Error; err != nil {
+		return 0, err
+	}
+	return u.TokenGeneration, nil
+}
+
+func (s *dbRevocationStore) RevokeAll(userID uuid.UUID) (int64, error) {
+	var gen int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("token_generation", gorm.Expr("token_generation + 1")).Error; err != nil {
+			return err
+		}
+		var u models.User
+		if err := tx.Select("token_generation").Where("id = ?", userID).First(&u).Error; err != nil {
+			return err
+		}
+		gen = u.TokenGeneration
+		return tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now().UTC()).Error
+	})
+	return gen, err
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 Appendix B test vectors.
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// The RFC lists 8-digit codes; the 6-digit codes are their last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, tt := range rfc6238Vectors {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	at := func(unix int64) time.Time { return time.Unix(unix, 0) }
+	const now = 1111111109
+	code := "081804"
+	step := int64(now / totpPeriod)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		now    time.Time
+		ok     bool
+	}{
+		{name: "current step", secret: rfc6238Secret, code: code, now: at(now), ok: true},
+		{name: "lowercase secret", secret: strings.ToLower(rfc6238Secret), code: code, now: at(now), ok: true},
+		{name: "spaces in code", secret: rfc6238Secret, code: "081 804", now: at(now), ok: true},
+		{name: "one step early", secret: rfc6238Secret, code: code, now: at(now - totpPeriod), ok: true},
+		{name: "one step late", secret: rfc6238Secret, code: code, now: at(now + totpPeriod), ok: true},
+		{name: "two steps early", secret: rfc6238Secret, code: code, now: at(now - 2*totpPeriod)},
+		{name: "two steps late", secret: rfc6238Secret, code: code, now: at(now + 2*totpPeriod)},
+		{name: "wrong code", secret: rfc6238Secret, code: "081805", now: at(now)},
+		{name: "eight digits", secret: rfc6238Secret, code: "07081804", now: at(now)},
+		{name: "empty code", secret: rfc6238Secret, code: "", now: at(now)},
+		{name: "invalid secret", secret: "not base32!", code: code, now: at(now)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(tt.secret, tt.code, tt.now)
+			if ok != tt.ok {
+				t.Fatalf("ValidateTOTP ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != step {
+				t.Errorf("ValidateTOTP step = %d, want %d", got, step)
+			}
+		})
+	}
+}
+
+// TestValidateTOTPReplay checks that the steps ValidateTOTP returns let a
+// caller that keeps the last accepted step, as checkSecondFactor does with
+// totp_last_step, turn away a code that was already used or an older one.
+func TestValidateTOTPReplay(t *testing.T) {
+	var last int64
+	accept := func(code string, now time.Time) bool {
+		step, ok := ValidateTOTP(rfc6238Secret, code, now)
+		if !ok || step <= last {
+			return false
+		}
+		last = step
+		return true
+	}
+	key := []byte("12345678901234567890")
+	now := time.Unix(1111111109, 0)
+	step := now.Unix() / totpPeriod
+	current, previous, next := totpCode(key, step), totpCode(key, step-1), totpCode(key, step+1)
+
+	if !accept(current, now) {
+		t.Fatal("current code rejected")
+	}
+	if accept(current, now.Add(10*time.Second)) {
+		t.Error("same code accepted twice")
+	}
+	if accept(previous, now) {
+		t.Error("code older than the last accepted one accepted")
+	}
+	if !accept(next, now) {
+		t.Error("code for the next step rejected")
+	}
+	if accept(current, now.Add(totpPeriod*time.Second)) {
+		t.Error("earlier code accepted after a later one")
+	}
+}
@@ -0,0 +1,170 @@
+// Package changelog records every write to a user's notes, categories and
+// attachments in a per-user, gap-free sequence. Sync hands out positions in that sequence as
+// opaque cursors.
+package changelog
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/your-org/notes-api/internal/models"
+)
+
+const (
+	EntityNote       = "note"
+	EntityCategory   = "category"
+	EntityAttachment = "attachment"
+
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Record appends a change for the given entity to the user's log. It must be
+// called inside the transaction that performs the write. Taking the next
+// sequence number locks the user's counter row until that transaction ends,
+// so changes become visible strictly in sequence order and a reader that has
+// seen seq N has also seen every change before it.
+func Record(tx *gorm.DB, userID uuid.UUID, entity string, entityID uuid.UUID, op string) (models.Change, error) {
+	counter := models.SyncCounter{UserID: userID, Seq: 1}
+	err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"seq": gorm.Expr("seq + 1")}),
+	}).Create(&counter).Error
+	if err != nil {
+		return models.Change{}, err
+	}
+	if err := tx.Where("user_id = ?", userID).First(&counter).Error; err != nil {
+		return models.Change{}, err
+	}
+	change := models.Change{
+		UserID:   userID,
+		Seq:      counter.Seq,
+		Entity:   entity,
+		EntityID: entityID,
+		Op:       op,
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return models.Change{}, err
+	}
+	return change, nil
+}
+
+// Since returns up to limit changes after seq, oldest first.
+func Since(db *gorm.DB, userID uuid.UUID, seq uint64, limit int) ([]models.Change, error) {
+	var changes []models.Change
+	err := db.Where("user_id = ? AND seq > ?", userID, seq).Order("seq asc").Limit(limit).Find(&changes).Error
+	return changes, err
+}
+
+const cursorPrefix = "1:"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor turns a sequence number into the opaque token given to clients.
+func EncodeCursor(seq uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatUint(seq, 10)))
+}
+
+// DecodeCursor reverses EncodeCursor. The empty cursor is the start of the log.
+func DecodeCursor(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || !strings.HasPrefix(string(b), cursorPrefix) {
+		return 0, ErrInvalidCursor
+	}
+	seq, err := strconv.ParseUint(strings.TrimPrefix(string(b), cursorPrefix), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
+
+// Backfill gives rows written before the change log existed an entry, so a
+// full sync from an empty cursor still returns them. Users that already have
+// a counter are skipped, which makes it cheap to run on every start.
+func Backfill(db *gorm.DB) error {
+	var userIDs []uuid.UUID
+	err := db.Raw(`SELECT user_id FROM notes WHERE user_id NOT IN (SELECT user_id FROM sync_counters)
+		UNION SELECT user_id FROM categories WHERE user_id NOT IN (SELECT user_id FROM sync_counters)`).
+		Scan(&userIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, uid := range userIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var cats []models.Category
+			if err := tx.Where("user_id = ?", uid).Order("updated_at asc").Find(&cats).Error; err != nil {
+				return err
+			}
+			for _, c := range cats {
+				if _, err := Record(tx, uid, EntityCategory, c.ID, OpCreate); err != nil {
+					return err
+				}
+			}
+			var notes []models.Note
+			if err := tx.Unscoped().Where("user_id = ?", uid).Order("updated_at asc").Find(&notes).Error; err != nil {
+				return err
+			}
+			for _, n := range notes {
+				op := OpCreate
+				if n.DeletedAt.Valid {
+					op = OpDelete
+				}
+				if _, err := Record(tx, uid, EntityNote, n.ID, op); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CursorExpired reports whether tombstones after seq have been purged, in
+// which case a client at seq has to start over with a full sync.
+func CursorExpired(db *gorm.DB, userID uuid.UUID, seq uint64) (bool, error) {
+	var counter models.SyncCounter
+	err := db.Where("user_id = ?", userID).Limit(1).Find(&counter).Error
+	if err != nil {
+		return false, err
+	}
+	return seq < counter.PurgedSeq, nil
+}
+
+// PurgeTombstones drops delete entries that every active device has already
+// pulled past. Devices that are revoked or were last seen before staleBefore
+// do not hold tombstones back; if they return with an old cursor they are
+// sent back to a full sync.
+func PurgeTombstones(db *gorm.DB, userID uuid.UUID, staleBefore time.Time) error {
+	var acked struct {
+		Seq   uint64
+		Count int64
+	}
+	err := db.Model(&models.Device{}).
+		Select("COALESCE(MIN(acked_seq), 0) AS seq, COUNT(*) AS count").
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at >= ?", userID, staleBefore).
+		Scan(&acked).Error
+	if err != nil || acked.Count == 0 || acked.Seq == 0 {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("user_id = ? AND op = ? AND seq <= ?", userID, OpDelete, acked.Seq).Delete(&models.Change{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&models.SyncCounter{}).Where("user_id = ?", userID).
+			Update("purged_seq", gorm.Expr("GREATEST(purged_seq, ?)", acked.Seq)).Error
+	})
+}
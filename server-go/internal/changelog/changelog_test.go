@@ -0,0 +1,51 @@
+package changelog
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, seq := range []uint64{0, 1, 42, math.MaxUint64} {
+		got, err := DecodeCursor(EncodeCursor(seq))
+		if err != nil || got != seq {
+			t.Errorf("DecodeCursor(EncodeCursor(%d)) = %d, %v", seq, got, err)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+		want   uint64
+		err    error
+	}{
+		{name: "empty is the start", cursor: "", want: 0},
+		{name: "valid", cursor: raw("1:17"), want: 17},
+		{name: "not base64", cursor: "!!!", err: ErrInvalidCursor},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte("1:17")), err: ErrInvalidCursor},
+		{name: "standard alphabet", cursor: "+/+/", err: ErrInvalidCursor},
+		{name: "missing prefix", cursor: raw("17"), err: ErrInvalidCursor},
+		{name: "unknown version", cursor: raw("2:17"), err: ErrInvalidCursor},
+		{name: "no sequence", cursor: raw("1:"), err: ErrInvalidCursor},
+		{name: "negative", cursor: raw("1:-5"), err: ErrInvalidCursor},
+		{name: "not a number", cursor: raw("1:abc"), err: ErrInvalidCursor},
+		{name: "trailing garbage", cursor: raw("1:17x"), err: ErrInvalidCursor},
+		{name: "overflow", cursor: raw("1:18446744073709551616"), err: ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(tt.cursor)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("DecodeCursor(%q) error = %v, want %v", tt.cursor, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("DecodeCursor(%q) = %d, want %d", tt.cursor, got, tt.want)
+			}
+		})
+	}
+}
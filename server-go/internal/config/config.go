@@ -2,19 +2,127 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Email verification policies: what unverified users may do.
+const (
+	VerificationAllow    = "allow"
+	VerificationReadOnly = "read_only"
+	VerificationBlock    = "block"
+)
+
+// DefaultJWTSecret is the placeholder JWT_SECRET. It is public, so it is
+// only accepted while APP_ENV is dev.
+const DefaultJWTSecret = "change-me"
+
+// OIDCProvider is an external OpenID Connect issuer users can log in with.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must be registered with the issuer. It points at
+	// /v1/auth/oidc/<name>/callback, or at an app that forwards the code.
+	RedirectURL string
+	Scopes      []string
+}
+
 type Config struct {
-	AppPort          string
-	AppEnv           string
-	JWTSecret        string
-	MySQLHost        string
-	MySQLPort        string
-	MySQLDB          string
-	MySQLUser        string
-	MySQLPass        string
-	CORSAllowOrigins string
-	StorageDir       string
+	AppPort   string
+	AppEnv    string
+	JWTSecret string
+	// JWTAlgorithm is HS256, RS256 or EdDSA. The asymmetric algorithms sign
+	// with JWTSigningKeyFile; JWTVerifyKeys lists retired public keys that
+	// are still accepted, as comma-separated kid=path pairs.
+	JWTAlgorithm      string
+	JWTSigningKeyFile string
+	JWTSigningKeyID   string
+	JWTVerifyKeys     string
+	JWTIssuer         string
+	JWTAudience       string
+	MySQLHost         string
+	MySQLPort         string
+	MySQLDB           string
+	MySQLUser         string
+	MySQLPass         string
+	CORSAllowOrigins  string
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header is believed. With none, the client IP
+	// used for login limits is always the connection's peer address.
+	TrustedProxies []string
+	StorageDir     string
+	// StorageLimit caps the bytes of attachments a user may store; 0 means
+	// no limit.
+	StorageLimit int64
+	// DeviceStaleAfter is how long a device may go unseen before it stops
+	// holding back the purge of sync tombstones.
+	DeviceStaleAfter time.Duration
+	// NoteRevisionsKeep is how many revisions are kept per note, and
+	// NoteRevisionsMaxAge how long they are kept; 0 means no limit. The
+	// current revision is always kept. Sync merges need the revision a
+	// client last saw, so a pruned one turns its edit into a conflict.
+	NoteRevisionsKeep   int
+	NoteRevisionsMaxAge time.Duration
+	// TrashRetention is how long deleted notes stay in the trash before
+	// the purge job, which runs every TrashPurgeInterval, removes them for
+	// good; 0 keeps them until the user does.
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	// AccessTokenTTL is the lifetime of a JWT; clients renew it with a
+	// refresh token, which lasts RefreshTokenTTL from its last use.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// AppURL is the base of links sent in email.
+	AppURL           string
+	PasswordResetTTL time.Duration
+	// EmailVerification is one of the Verification* policies.
+	EmailVerification string
+	VerifyEmailTTL    time.Duration
+	// TOTPIssuer is the account name prefix shown in authenticator apps.
+	TOTPIssuer string
+	// OIDCProviders come from OIDC_PROVIDERS, a comma-separated list of
+	// names, each configured by OIDC_<NAME>_ISSUER, _CLIENT_ID,
+	// _CLIENT_SECRET, _REDIRECT_URL and optionally _SCOPES.
+	OIDCProviders []OIDCProvider
+	// PasswordHash is argon2id or bcrypt, with the parameters below; hashes
+	// made otherwise are upgraded at the user's next login. Argon2Memory is
+	// in KiB.
+	PasswordHash      string
+	BcryptCost        int
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	// New passwords must be PasswordMinLength to PasswordMaxLength
+	// characters and must not appear in PasswordBreachedList, a file with
+	// one password per line.
+	PasswordMinLength    int
+	PasswordMaxLength    int
+	PasswordBreachedList string
+	// LoginAttemptStore is memory (one instance) or db (shared by all
+	// instances). After LoginFreeAttempts failed logins, each failure delays
+	// the next attempt by LoginBackoffBase, doubling up to LoginBackoffMax.
+	// LoginLockoutThreshold failures lock an account, and
+	// LoginIPLockoutThreshold an IP address, for LoginLockoutDuration.
+	// Failures older than LoginAttemptWindow are forgotten.
+	LoginAttemptStore       string
+	LoginFreeAttempts       int
+	LoginBackoffBase        time.Duration
+	LoginBackoffMax         time.Duration
+	LoginLockoutThreshold   int
+	LoginIPLockoutThreshold int
+	LoginLockoutDuration    time.Duration
+	LoginAttemptWindow      time.Duration
+	// MailDriver is smtp, file (one .eml per message in MailDir) or log.
+	MailDriver string
+	MailFrom   string
+	MailDir    string
+	SMTPHost   string
+	SMTPPort   string
+	SMTPUser   string
+	SMTPPass   string
 }
 
 func getenv(key, def string) string {
@@ -24,17 +132,110 @@ func getenv(key, def string) string {
 	return def
 }
 
+func getenvDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+func getenvInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// splitList splits a comma-separated setting, dropping empty items.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func loadOIDCProviders() []OIDCProvider {
+	var out []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		out = append(out, OIDCProvider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(getenv(prefix+"ISSUER", ""), "/"),
+			ClientID:     getenv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getenv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getenv(prefix+"REDIRECT_URL", ""),
+			Scopes:       strings.Fields(getenv(prefix+"SCOPES", "openid email profile")),
+		})
+	}
+	return out
+}
+
 func Load() Config {
 	return Config{
-		AppPort:          getenv("APP_PORT", "8080"),
-		AppEnv:           getenv("APP_ENV", "dev"),
-		JWTSecret:        getenv("JWT_SECRET", "change-me"),
-		MySQLHost:        getenv("MYSQL_HOST", "mysql"),
-		MySQLPort:        getenv("MYSQL_PORT", "3306"),
-		MySQLDB:          getenv("MYSQL_DB", "notes"),
-		MySQLUser:        getenv("MYSQL_USER", "notes"),
-		MySQLPass:        getenv("MYSQL_PASS", "notes"),
-		CORSAllowOrigins: getenv("CORS_ALLOW_ORIGINS", "*"),
-		StorageDir:       getenv("STORAGE_DIR", "/var/app/storage"),
+		AppPort:                 getenv("APP_PORT", "8080"),
+		AppEnv:                  getenv("APP_ENV", "dev"),
+		JWTSecret:               getenv("JWT_SECRET", DefaultJWTSecret),
+		JWTAlgorithm:            getenv("JWT_ALGORITHM", "HS256"),
+		JWTSigningKeyFile:       getenv("JWT_SIGNING_KEY_FILE", ""),
+		JWTSigningKeyID:         getenv("JWT_SIGNING_KEY_ID", ""),
+		JWTVerifyKeys:           getenv("JWT_VERIFY_KEYS", ""),
+		JWTIssuer:               getenv("JWT_ISSUER", "notes-api"),
+		JWTAudience:             getenv("JWT_AUDIENCE", "notes-app"),
+		MySQLHost:               getenv("MYSQL_HOST", "mysql"),
+		MySQLPort:               getenv("MYSQL_PORT", "3306"),
+		MySQLDB:                 getenv("MYSQL_DB", "notes"),
+		MySQLUser:               getenv("MYSQL_USER", "notes"),
+		MySQLPass:               getenv("MYSQL_PASS", "notes"),
+		CORSAllowOrigins:        getenv("CORS_ALLOW_ORIGINS", "*"),
+		TrustedProxies:          splitList(getenv("TRUSTED_PROXIES", "")),
+		StorageDir:              getenv("STORAGE_DIR", "/var/app/storage"),
+		StorageLimit:            int64(getenvInt("STORAGE_LIMIT", 100*1024*1024)),
+		DeviceStaleAfter:        getenvDuration("DEVICE_STALE_AFTER", 90*24*time.Hour),
+		NoteRevisionsKeep:       getenvInt("NOTE_REVISIONS_KEEP", 50),
+		NoteRevisionsMaxAge:     getenvDuration("NOTE_REVISIONS_MAX_AGE", 0),
+		TrashRetention:          getenvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		TrashPurgeInterval:      getenvDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		AccessTokenTTL:          getenvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:         getenvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		AppURL:                  getenv("APP_URL", "http://localhost:8080"),
+		PasswordResetTTL:        getenvDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerification:       getenv("EMAIL_VERIFICATION", VerificationAllow),
+		VerifyEmailTTL:          getenvDuration("VERIFY_EMAIL_TTL", 48*time.Hour),
+		TOTPIssuer:              getenv("TOTP_ISSUER", "Notes"),
+		OIDCProviders:           loadOIDCProviders(),
+		PasswordHash:            getenv("PASSWORD_HASH", "argon2id"),
+		BcryptCost:              getenvInt("BCRYPT_COST", 12),
+		Argon2Memory:            getenvInt("ARGON2_MEMORY", 19*1024),
+		Argon2Iterations:        getenvInt("ARGON2_ITERATIONS", 2),
+		Argon2Parallelism:       getenvInt("ARGON2_PARALLELISM", 1),
+		PasswordMinLength:       getenvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:       getenvInt("PASSWORD_MAX_LENGTH", 128),
+		PasswordBreachedList:    getenv("PASSWORD_BREACHED_LIST", ""),
+		LoginAttemptStore:       getenv("LOGIN_ATTEMPT_STORE", "memory"),
+		LoginFreeAttempts:       getenvInt("LOGIN_FREE_ATTEMPTS", 3),
+		LoginBackoffBase:        getenvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:         getenvDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+		LoginLockoutThreshold:   getenvInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LoginIPLockoutThreshold: getenvInt("LOGIN_IP_LOCKOUT_THRESHOLD", 100),
+		LoginLockoutDuration:    getenvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginAttemptWindow:      getenvDuration("LOGIN_ATTEMPT_WINDOW", time.Hour),
+		MailDriver:              getenv("MAIL_DRIVER", "log"),
+		MailFrom:                getenv("MAIL_FROM", "Notes <no-reply@notes-app.com>"),
+		MailDir:                 getenv("MAIL_DIR", "/var/app/mail"),
+		SMTPHost:                getenv("SMTP_HOST", ""),
+		SMTPPort:                getenv("SMTP_PORT", "587"),
+		SMTPUser:                getenv("SMTP_USER", ""),
+		SMTPPass:                getenv("SMTP_PASS", ""),
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
+	"github.com/your-org/notes-api/internal/changelog"
 	"github.com/your-org/notes-api/internal/config"
 	"github.com/your-org/notes-api/internal/models"
 )
@@ -21,7 +22,10 @@ func Init(cfg config.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 	// Auto-migrate schema
-	if err := db.AutoMigrate(&models.User{}, &models.Category{}, &models.Note{}, &models.Attachment{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.Category{}, &models.Note{}, &models.NoteRevision{}, &models.SyncMutation{}, &models.SyncCounter{}, &models.Change{}, &models.Device{}, &models.Attachment{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.OneTimeToken{}, &models.RecoveryCode{}, &models.PersonalAccessToken{}, &models.UserIdentity{}, &models.OIDCLogin{}, &models.LoginAttempt{}, &models.AuditLog{}); err != nil {
+		return nil, err
+	}
+	if err := changelog.Backfill(db); err != nil {
 		return nil, err
 	}
 	return db, nil
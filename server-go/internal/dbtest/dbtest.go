@@ -0,0 +1,143 @@
+// Package dbtest opens a *gorm.DB on a scripted fake driver, for tests that
+// need to answer or inspect the SQL a function runs without a MySQL server.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Result is the answer to one statement. Queries return Columns and Rows;
+// Execs return RowsAffected. A non-nil Err fails the statement.
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	RowsAffected int64
+	Err          error
+}
+
+// Handler answers a statement. It is called with the SQL as gorm renders it
+// for MySQL, with ? placeholders, and the arguments after driver conversion,
+// so UUIDs arrive as strings.
+type Handler func(query string, args []driver.Value) Result
+
+// Open returns a gorm DB whose every statement is answered by h. Statements
+// are serialised, so h need not be safe for concurrent use.
+func Open(t testing.TB, h Handler) *gorm.DB {
+	t.Helper()
+	sqlDB := sql.OpenDB(&connector{h: h})
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	return db
+}
+
+// Match reports whether query starts with prefix, ignoring the backquotes
+// gorm puts around names and any leading whitespace.
+func Match(query, prefix string) bool {
+	return strings.HasPrefix(strings.TrimSpace(strings.ReplaceAll(query, "`", "")), prefix)
+}
+
+type connector struct {
+	mu sync.Mutex
+	h  Handler
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) { return &conn{c: c}, nil }
+func (c *connector) Driver() driver.Driver                        { return fakeDriver{} }
+
+func (c *connector) answer(query string, args []driver.NamedValue) Result {
+	vals := make([]driver.Value, len(args))
+	for i, a := range args {
+		vals[i] = a.Value
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.h(query, vals)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, driver.ErrSkip }
+
+type conn struct{ c *connector }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{c: c.c, query: query}, nil }
+func (c *conn) Close() error                              { return nil }
+func (c *conn) Begin() (driver.Tx, error)                 { return tx{}, nil }
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res := c.c.answer(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return &rows{cols: res.Columns, rows: res.Rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res := c.c.answer(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return driver.RowsAffected(res.RowsAffected), nil
+}
+
+type stmt struct {
+	c     *connector
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return (&conn{c: s.c}).ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return (&conn{c: s.c}).QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	out := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		out[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return out
+}
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type rows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.cols }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
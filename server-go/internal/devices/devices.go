@@ -0,0 +1,66 @@
+// Package devices tracks the clients a user syncs from.
+package devices
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// Info is what a client reports about itself. Only ID is required.
+type Info struct {
+	ID         string `json:"id" validate:"required,max=100"`
+	Name       string `json:"name" validate:"max=100"`
+	Platform   string `json:"platform" validate:"max=50"`
+	AppVersion string `json:"app_version" validate:"max=50"`
+}
+
+// Seen registers the device on first use and otherwise refreshes its
+// last-seen time and any details the client reported. It does not check
+// whether the device was revoked; callers decide what that means.
+func Seen(db *gorm.DB, userID uuid.UUID, info Info) (models.Device, error) {
+	now := time.Now().UTC()
+	d := models.Device{
+		ID:         uuid.New(),
+		UserID:     userID,
+		DeviceID:   info.ID,
+		Name:       info.Name,
+		Platform:   info.Platform,
+		AppVersion: info.AppVersion,
+		LastSeenAt: now,
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&d).Error; err != nil {
+		return d, err
+	}
+	if err := db.Where("user_id = ? AND device_id = ?", userID, info.ID).First(&d).Error; err != nil {
+		return d, err
+	}
+	updates := map[string]interface{}{"last_seen_at": now}
+	if info.Name != "" && info.Name != d.Name {
+		updates["name"] = info.Name
+	}
+	if info.Platform != "" && info.Platform != d.Platform {
+		updates["platform"] = info.Platform
+	}
+	if info.AppVersion != "" && info.AppVersion != d.AppVersion {
+		updates["app_version"] = info.AppVersion
+	}
+	if err := db.Model(&d).Updates(updates).Error; err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// Reactivate clears a revocation. Logging in again with a password on a
+// revoked device is how a user brings it back.
+func Reactivate(db *gorm.DB, d *models.Device) error {
+	if d.RevokedAt == nil {
+		return nil
+	}
+	d.RevokedAt = nil
+	return db.Model(d).Update("revoked_at", nil).Error
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/audit"
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/mailer"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+var errEmailTaken = errors.New("email already registered")
+
+// reauthWindow is how recently a user without a password or 2FA must have
+// logged in to make a sensitive change.
+const reauthWindow = 10 * time.Minute
+
+type updateMeReq struct {
+	Name *string `json:"name" validate:"omitempty,min=1,max=100"`
+}
+
+// Sensitive changes are confirmed with the current password. Users who have
+// none, such as those who signed up through an identity provider, leave it
+// out and send a 2FA code instead; see checkPassword.
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" validate:"required"`
+	secondFactorReq
+}
+
+type changeEmailReq struct {
+	NewEmail        string `json:"new_email" validate:"required,email,max=255"`
+	CurrentPassword string `json:"current_password"`
+	secondFactorReq
+}
+
+type deleteAccountReq struct {
+	Password string `json:"password"`
+	secondFactorReq
+}
+
+// Me returns the current user's profile and storage usage.
+func (h *AuthHandler) Me(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	h.respondMe(c, user)
+}
+
+// UpdateMe changes profile fields. Only the name can be edited here; email
+// and password have their own endpoints.
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	var req updateMeReq
+	if err := c.ShouldBindJSON(&req); err != nil || h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if req.Name != nil {
+		user.Name = *req.Name
+		if err := h.db.Model(&user).Update("name", user.Name).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to update profile"})
+			return
+		}
+	}
+	h.respondMe(c, user)
+}
+
+// ChangePassword sets a new password and signs out every other session. The
+// current session continues with the token pair in the response; the token
+// the request was made with stops working.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req changePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil || h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok || !h.checkPassword(c, user, req.CurrentPassword, req.secondFactorReq) || h.weakPassword(c, req.NewPassword) {
+		return
+	}
+	hash, err := h.passwords.Hash(req.NewPassword)
+	if err == nil {
+		err = h.db.Model(&user).Update("password_hash", hash).Error
+	}
+	if err == nil {
+		user.TokenGeneration, err = h.revocations.RevokeAll(user.ID)
+	}
+	if err == nil {
+		err = auth.RevokePATs(h.db, user.ID)
+	}
+	var token, refresh string
+	if err == nil {
+		token, refresh, err = h.issueTokens(user, c.GetString("device_id"))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to change password"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password changed; other sessions have been signed out",
+		"data": gin.H{
+			"token":         token,
+			"refresh_token": refresh,
+			"expires_in":    int64(h.cfg.AccessTokenTTL.Seconds()),
+		},
+	})
+}
+
+// ChangeEmail starts an email change. The address stays as it is until the
+// user follows the link sent to the new one, which also verifies it. The
+// old address is told about the request.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	var req changeEmailReq
+	if err := c.ShouldBindJSON(&req); err != nil || h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok || !h.checkPassword(c, user, req.CurrentPassword, req.secondFactorReq) {
+		return
+	}
+	if req.NewEmail == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "That is already your email address", "code": "VALIDATION_ERROR"})
+		return
+	}
+	var n int64
+	if err := h.db.Model(&models.User{}).Where("email = ?", req.NewEmail).Count(&n).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to change email"})
+		return
+	}
+	if n > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Email already exists", "code": "EMAIL_EXISTS"})
+		return
+	}
+	token, err := auth.IssueOneTimeData(h.db, user.ID, auth.PurposeEmailChange, req.NewEmail, h.cfg.VerifyEmailTTL)
+	if err == nil {
+		link := h.cfg.AppURL + "/verify-email?token=" + url.QueryEscape(token)
+		err = h.mail.Send(mailer.Message{
+			To:      req.NewEmail,
+			Subject: "Confirm your new email address",
+			Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that you want to use this address for your account by opening this link:\n\n%s\n\nOr enter this code in the app: %s\n\nThe link expires in %s.\n",
+				user.Name, link, token, h.cfg.VerifyEmailTTL),
+		})
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to send email"})
+		return
+	}
+	_ = h.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone signed in to your account asked to change its email address to %s. If this was not you, change your password now.\n",
+			user.Name, req.NewEmail),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Check the new address for a confirmation link",
+		"data":    gin.H{"pending_email": req.NewEmail},
+	})
+}
+
+// confirmEmailChange switches the user to the address an email change token
+// was sent to, which also counts as verifying it.
+func confirmEmailChange(tx *gorm.DB, t models.OneTimeToken) error {
+	var n int64
+	if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", t.Data, t.UserID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return errEmailTaken
+	}
+	return tx.Model(&models.User{}).Where("id = ?", t.UserID).Updates(map[string]interface{}{
+		"email":       t.Data,
+		"verified_at": time.Now().UTC(),
+	}).Error
+}
+
+// DeleteMe deletes the account and everything in it: notes, categories,
+// attachments with their files, devices and every credential.
+func (h *AuthHandler) DeleteMe(c *gin.Context) {
+	var req deleteAccountReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request", "code": "VALIDATION_ERROR"})
+			return
+		}
+	}
+	user, ok := h.currentUser(c)
+	if !ok || !h.checkPassword(c, user, req.Password, req.secondFactorReq) {
+		return
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error { return deleteAccount(tx, user.ID) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to delete account"})
+		return
+	}
+	// The rows are gone, so files left behind by a failure here are
+	// unreachable; they do not block the deletion.
+	_ = os.RemoveAll(filepath.Join(h.cfg.StorageDir, user.ID.String()))
+	_ = h.guard.Succeed(user.Email)
+	_ = audit.Record(h.db, audit.EventAccountDeleted, &user.ID, c.ClientIP(), nil)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Account deleted"})
+}
+
+// deleteAccount removes a user and every row that belongs to them. Audit
+// log entries are kept.
+func deleteAccount(tx *gorm.DB, uid uuid.UUID) error {
+	owned := []interface{}{
+		&models.Note{}, &models.NoteRevision{}, &models.Category{}, &models.Attachment{},
+		&models.Change{}, &models.SyncMutation{}, &models.SyncCounter{}, &models.Device{},
+		&models.RefreshToken{}, &models.RevokedToken{}, &models.OneTimeToken{}, &models.RecoveryCode{},
+		&models.PersonalAccessToken{}, &models.UserIdentity{},
+	}
+	for _, m := range owned {
+		if err := tx.Unscoped().Where("user_id = ?", uid).Delete(m).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("id = ?", uid).Delete(&models.User{}).Error
+}
+
+func (h *AuthHandler) currentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if err := h.db.Where("id = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load user"})
+		return user, false
+	}
+	return user, true
+}
+
+// checkPassword confirms a sensitive change with the user's password, which
+// is throttled like a login. Users without a password confirm it with a 2FA
+// code or recovery code if they have 2FA on; otherwise, or without a code,
+// they must have logged in within reauthWindow. It reports whether the
+// change may go ahead, having responded if not.
+func (h *AuthHandler) checkPassword(c *gin.Context, user models.User, password string, second secondFactorReq) bool {
+	if user.PasswordHash == "" {
+		return h.checkReauth(c, user, second)
+	}
+	if h.throttled(c, user.Email) {
+		return false
+	}
+	if ok, _ := h.passwords.Verify(user.PasswordHash, password); !ok {
+		if !h.loginFailed(c, user.Email, &user.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Current password is incorrect", "code": "INVALID_CREDENTIALS"})
+		}
+		return false
+	}
+	return true
+}
+
+func (h *AuthHandler) checkReauth(c *gin.Context, user models.User, second secondFactorReq) bool {
+	if user.TOTPEnabledAt != nil && (second.Code != "" || second.RecoveryCode != "") {
+		return h.verifySecondFactor(c, user, second)
+	}
+	if at, ok := c.Get("auth_time"); ok && time.Since(at.(time.Time)) <= reauthWindow {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Log in again to confirm this change", "code": "REAUTH_REQUIRED"})
+	return false
+}
+
+func (h *AuthHandler) respondMe(c *gin.Context, user models.User) {
+	used, err := storageUsed(h.db, user.ID)
+	var pending []string
+	if err == nil {
+		err = h.db.Model(&models.OneTimeToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", user.ID, auth.PurposeEmailChange, time.Now().UTC()).
+			Pluck("data", &pending).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load user"})
+		return
+	}
+	var pendingEmail *string
+	if len(pending) > 0 {
+		pendingEmail = &pending[0]
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"user": gin.H{
+		"id":                 user.ID,
+		"email":              user.Email,
+		"name":               user.Name,
+		"verified_at":        user.VerifiedAt,
+		"pending_email":      pendingEmail,
+		"has_password":       user.PasswordHash != "",
+		"two_factor_enabled": user.TOTPEnabledAt != nil,
+		"created_at":         user.CreatedAt,
+		"storage_used":       used,
+		"storage_limit":      h.cfg.StorageLimit,
+	}}})
+}
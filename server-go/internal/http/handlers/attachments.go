@@ -1,62 +1,271 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"github.com/your-org/notes-api/internal/changelog"
 	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/realtime"
 )
 
+const maxAttachmentSize = 10 * 1024 * 1024
+
+// errStorageQuota means an upload does not fit in STORAGE_LIMIT.
+var errStorageQuota = errors.New("storage quota exceeded")
+
+// stagedAttachmentTTL is how long an upload may wait to be bound to a note by
+// a sync push before it is discarded.
+const stagedAttachmentTTL = 24 * time.Hour
+
 type AttachmentsHandler struct {
 	cfg config.Config
 	db  *gorm.DB
+	hub *realtime.Hub
+}
+
+func NewAttachmentsHandler(cfg config.Config, db *gorm.DB, hub *realtime.Hub) *AttachmentsHandler {
+	return &AttachmentsHandler{cfg: cfg, db: db, hub: hub}
 }
 
-func NewAttachmentsHandler(cfg config.Config, db *gorm.DB) *AttachmentsHandler {
-	return &AttachmentsHandler{cfg: cfg, db: db}
+func attachmentJSON(a models.Attachment) gin.H {
+	return gin.H{
+		"id":          a.ID,
+		"note_id":     a.NoteID,
+		"filename":    a.FileName,
+		"size":        a.Size,
+		"mime_type":   a.MimeType,
+		"url":         "/v1/attachments/" + a.ID.String(),
+		"uploaded_at": a.CreatedAt,
+	}
 }
 
+// Upload stores a file and attaches it to an existing note.
 func (h *AttachmentsHandler) Upload(c *gin.Context) {
-	// NOTE: Simplified: store file locally under STORAGE_DIR
-	userID := c.GetString("user_id")
-	_ = userID // could verify permissions using note->user mapping
-	noteID := c.Param("id")
-	file, err := c.FormFile("file")
+	uid := uuid.MustParse(c.GetString("user_id"))
+	var note models.Note
+	if err := h.db.Where("user_id = ? AND id = ?", uid, c.Param("id")).First(&note).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
+		return
+	}
+	file, ok := h.formFile(c, uid)
+	if !ok {
+		return
+	}
+	a, path, err := h.save(c, uid, file)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "File is required", "code": "VALIDATION_ERROR"})
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to save file"})
 		return
 	}
-	if file.Size > 10*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "File too large", "code": "FILE_TOO_LARGE"})
+	a.NoteID = &note.ID
+	var change models.Change
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := h.create(tx, &a); err != nil {
+			return err
+		}
+		var err error
+		change, err = changelog.Record(tx, uid, changelog.EntityAttachment, a.ID, changelog.OpCreate)
+		return err
+	})
+	if errors.Is(err, errStorageQuota) {
+		_ = os.Remove(path)
+		storageQuotaExceeded(c)
 		return
 	}
-	id := uuid.New().String()
-	dir := filepath.Join(h.cfg.StorageDir, noteID)
-	_ = os.MkdirAll(dir, 0o755)
-	path := filepath.Join(dir, fmt.Sprintf("%s_%s", id, filepath.Base(file.Filename)))
-	if err := c.SaveUploadedFile(file, path); err != nil {
+	if err != nil {
+		_ = os.Remove(path)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to save file"})
 		return
 	}
+	h.hub.Publish(change)
 	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "File uploaded successfully", "data": gin.H{
-		"attachment": gin.H{
-			"id":          id,
-			"filename":    file.Filename,
-			"size":        file.Size,
-			"mime_type":   file.Header.Get("Content-Type"),
-			"url":         fmt.Sprintf("/files/%s/%s", noteID, filepath.Base(path)),
-			"uploaded_at": "",
-		},
+		"attachment": attachmentJSON(a),
 	}})
 }
 
+// Stage stores a file that is not attached to a note yet. Offline clients use
+// it for notes that only exist locally, then bind the returned ID to the note
+// in the same POST /sync that creates it.
+func (h *AttachmentsHandler) Stage(c *gin.Context) {
+	uid := uuid.MustParse(c.GetString("user_id"))
+	file, ok := h.formFile(c, uid)
+	if !ok {
+		return
+	}
+	a, path, err := h.save(c, uid, file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to save file"})
+		return
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		return h.create(tx, &a)
+	})
+	if errors.Is(err, errStorageQuota) {
+		_ = os.Remove(path)
+		storageQuotaExceeded(c)
+		return
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to save file"})
+		return
+	}
+	h.discardStaged(uid)
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "File uploaded successfully", "data": gin.H{
+		"attachment": attachmentJSON(a),
+	}})
+}
+
+// Download serves an attachment's file to its owner.
+func (h *AttachmentsHandler) Download(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var a models.Attachment
+	if err := h.db.Where("user_id = ? AND id = ?", userID, c.Param("id")).First(&a).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Attachment not found", "code": "ATTACHMENT_NOT_FOUND"})
+		return
+	}
+	c.Header("Content-Type", a.MimeType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.FileAttachment(a.StoragePath, a.FileName)
+}
+
 func (h *AttachmentsHandler) Delete(c *gin.Context) {
-	// Simplified: not tracking on DB for now
+	uid := uuid.MustParse(c.GetString("user_id"))
+	var a models.Attachment
+	var change models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND id = ?", uid, c.Param("id")).First(&a).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&a).Error; err != nil {
+			return err
+		}
+		if a.NoteID == nil {
+			return nil
+		}
+		var err error
+		change, err = changelog.Record(tx, uid, changelog.EntityAttachment, a.ID, changelog.OpDelete)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Attachment not found", "code": "ATTACHMENT_NOT_FOUND"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to delete attachment"})
+		return
+	}
+	_ = os.Remove(a.StoragePath)
+	if a.NoteID != nil {
+		h.hub.Publish(change)
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Attachment deleted successfully"})
 }
+
+func (h *AttachmentsHandler) formFile(c *gin.Context, uid uuid.UUID) (*multipart.FileHeader, bool) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "File is required", "code": "VALIDATION_ERROR"})
+		return nil, false
+	}
+	if file.Size > maxAttachmentSize {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "File too large", "code": "FILE_TOO_LARGE"})
+		return nil, false
+	}
+	if h.cfg.StorageLimit > 0 {
+		used, err := storageUsed(h.db, uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to save file"})
+			return nil, false
+		}
+		if used+file.Size > h.cfg.StorageLimit {
+			storageQuotaExceeded(c)
+			return nil, false
+		}
+	}
+	return file, true
+}
+
+func storageQuotaExceeded(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Storage limit reached", "code": "STORAGE_QUOTA_EXCEEDED"})
+}
+
+// create inserts a new attachment row. formFile only checks the quota as a
+// fast path: under a storage limit the user's row is locked here, so that
+// parallel uploads are counted against it one at a time, and the upload
+// fails with errStorageQuota if it no longer fits.
+func (h *AttachmentsHandler) create(tx *gorm.DB, a *models.Attachment) error {
+	if h.cfg.StorageLimit > 0 {
+		var u models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", a.UserID).First(&u).Error; err != nil {
+			return err
+		}
+		used, err := storageUsed(tx, a.UserID)
+		if err != nil {
+			return err
+		}
+		if used+a.Size > h.cfg.StorageLimit {
+			return errStorageQuota
+		}
+	}
+	return tx.Create(a).Error
+}
+
+// storageUsed returns the bytes of attachments the user stores, staged
+// uploads included.
+func storageUsed(db *gorm.DB, uid uuid.UUID) (int64, error) {
+	var used int64
+	err := db.Model(&models.Attachment{}).Where("user_id = ?", uid).Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+	return used, err
+}
+
+// save writes an upload to STORAGE_DIR/<user id>/ and returns the unsaved
+// attachment row describing it, together with the file's path.
+func (h *AttachmentsHandler) save(c *gin.Context, uid uuid.UUID, file *multipart.FileHeader) (models.Attachment, string, error) {
+	id := uuid.New()
+	dir := filepath.Join(h.cfg.StorageDir, uid.String())
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return models.Attachment{}, "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s", id, filepath.Base(file.Filename)))
+	if err := c.SaveUploadedFile(file, path); err != nil {
+		return models.Attachment{}, "", err
+	}
+	mimeType := file.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return models.Attachment{
+		ID:          id,
+		UserID:      uid,
+		FileName:    filepath.Base(file.Filename),
+		MimeType:    mimeType,
+		Size:        file.Size,
+		StoragePath: path,
+	}, path, nil
+}
+
+// discardStaged removes the user's staged uploads that were never bound to a
+// note. Failures are left for the next upload to retry.
+func (h *AttachmentsHandler) discardStaged(uid uuid.UUID) {
+	var stale []models.Attachment
+	if err := h.db.Where("user_id = ? AND note_id IS NULL AND created_at < ?", uid, time.Now().Add(-stagedAttachmentTTL)).Find(&stale).Error; err != nil {
+		return
+	}
+	for _, a := range stale {
+		if err := h.db.Delete(&a).Error; err == nil {
+			_ = os.Remove(a.StoragePath)
+		}
+	}
+}
@@ -1,39 +1,56 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
 	"github.com/google/uuid"
+	"github.com/your-org/notes-api/internal/auth"
 	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/devices"
+	"github.com/your-org/notes-api/internal/mailer"
 	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/oidc"
+	"github.com/your-org/notes-api/internal/password"
 )
 
+// errEmailNotVerified means the verification policy refuses the user tokens.
+var errEmailNotVerified = errors.New("email not verified")
+
 type AuthHandler struct {
-	cfg config.Config
-	db  *gorm.DB
-	v   *validator.Validate
+	cfg         config.Config
+	db          *gorm.DB
+	v           *validator.Validate
+	keys        *auth.KeySet
+	revocations auth.RevocationStore
+	mail        mailer.Mailer
+	oidc        *oidc.Registry
+	guard       *auth.LoginGuard
+	passwords   password.Hasher
+	policy      *password.Policy
 }
 
-func NewAuthHandler(cfg config.Config, db *gorm.DB) *AuthHandler {
-	return &AuthHandler{cfg: cfg, db: db, v: validator.New()}
+func NewAuthHandler(cfg config.Config, db *gorm.DB, keys *auth.KeySet, revocations auth.RevocationStore, mail mailer.Mailer, providers *oidc.Registry, guard *auth.LoginGuard, passwords password.Hasher, policy *password.Policy) *AuthHandler {
+	return &AuthHandler{cfg: cfg, db: db, v: validator.New(), keys: keys, revocations: revocations, mail: mail, oidc: providers, guard: guard, passwords: passwords, policy: policy}
 }
 
 type registerReq struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
-	Name     string `json:"name" validate:"required,max=100"`
+	Email    string        `json:"email" validate:"required,email"`
+	Password string        `json:"password" validate:"required"`
+	Name     string        `json:"name" validate:"required,max=100"`
+	Device   *devices.Info `json:"device"`
 }
 
 type loginReq struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Email    string        `json:"email" validate:"required,email"`
+	Password string        `json:"password" validate:"required"`
+	Device   *devices.Info `json:"device"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -51,29 +68,60 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Email already exists", "code": "EMAIL_EXISTS"})
 		return
 	}
-	hash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if h.weakPassword(c, req.Password) {
+		return
+	}
+	hash, err := h.passwords.Hash(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create user"})
+		return
+	}
 	user := models.User{
 		ID:           uuid.New(),
 		Name:         req.Name,
 		Email:        req.Email,
-		PasswordHash: string(hash),
+		PasswordHash: hash,
 	}
 	if err := h.db.Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create user"})
 		return
 	}
-	token := h.signToken(user.ID.String())
+	// A failed send is not fatal: the account exists, and the user can ask
+	// for the email again.
+	_ = h.sendVerification(user)
+	userJSON := gin.H{
+		"id":          user.ID,
+		"email":       user.Email,
+		"name":        user.Name,
+		"verified_at": user.VerifiedAt,
+		"created_at":  user.CreatedAt,
+	}
+	if h.cfg.EmailVerification == config.VerificationBlock {
+		c.JSON(http.StatusCreated, gin.H{
+			"success": true,
+			"message": "User registered successfully; verify your email address to log in",
+			"data":    gin.H{"user": userJSON, "verification_required": true},
+		})
+		return
+	}
+	deviceID, err := h.registerDevice(user.ID, req.Device)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to register device"})
+		return
+	}
+	token, refresh, err := h.issueTokens(user, deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to issue token"})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
 		"message": "User registered successfully",
 		"data": gin.H{
-			"user": gin.H{
-				"id":         user.ID,
-				"email":      user.Email,
-				"name":       user.Name,
-				"created_at": user.CreatedAt,
-			},
-			"token": token,
+			"user":          userJSON,
+			"token":         token,
+			"refresh_token": refresh,
+			"expires_in":    int64(h.cfg.AccessTokenTTL.Seconds()),
 		},
 	})
 }
@@ -88,36 +136,210 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
 		return
 	}
+	if h.throttled(c, req.Email) {
+		return
+	}
 	var user models.User
 	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid credentials", "code": "INVALID_CREDENTIALS"})
+		if !h.loginFailed(c, req.Email, nil) {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid credentials", "code": "INVALID_CREDENTIALS"})
+		}
+		return
+	}
+	ok, rehash := h.passwords.Verify(user.PasswordHash, req.Password)
+	if !ok {
+		if !h.loginFailed(c, req.Email, &user.ID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid credentials", "code": "INVALID_CREDENTIALS"})
+		}
 		return
 	}
-	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid credentials", "code": "INVALID_CREDENTIALS"})
+	// Upgrade the stored hash to the current algorithm and parameters while
+	// the plain password is at hand. Failing to is not worth failing the
+	// login over; the next one tries again.
+	if rehash {
+		if hash, err := h.passwords.Hash(req.Password); err == nil {
+			_ = h.db.Model(&user).Update("password_hash", hash).Error
+		}
+	}
+	if h.blockedUnverified(user) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Email address is not verified", "code": "EMAIL_NOT_VERIFIED"})
+		return
+	}
+	// A 2FA user's failures are cleared only once the second factor passes.
+	if user.TOTPEnabledAt != nil {
+		h.challenge(c, user, req.Device)
+		return
+	}
+	if err := h.guard.Succeed(req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to log in"})
+		return
+	}
+	h.completeLogin(c, user, req.Device)
+}
+
+// completeLogin registers the client's device and responds with a fresh
+// token pair. It is the last step of every successful login.
+func (h *AuthHandler) completeLogin(c *gin.Context, user models.User, info *devices.Info) {
+	deviceID, err := h.registerDevice(user.ID, info)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to register device"})
+		return
+	}
+	token, refresh, err := h.issueTokens(user, deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to issue token"})
 		return
 	}
-	token := h.signToken(user.ID.String())
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Login successful",
 		"data": gin.H{
-			"user":  gin.H{"id": user.ID, "email": user.Email, "name": user.Name},
-			"token": token,
+			"user":          gin.H{"id": user.ID, "email": user.Email, "name": user.Name, "verified_at": user.VerifiedAt},
+			"token":         token,
+			"refresh_token": refresh,
+			"expires_in":    int64(h.cfg.AccessTokenTTL.Seconds()),
+		},
+	})
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. The old refresh token stops working; presenting it again revokes
+// every token descended from the same login.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Refresh token is required", "code": "VALIDATION_ERROR"})
+		return
+	}
+	// The access token is signed before the rotation commits, so a failure
+	// leaves the client holding a refresh token that still works.
+	var token string
+	refresh, _, err := auth.Rotate(h.db, req.RefreshToken, h.cfg.RefreshTokenTTL, func(tx *gorm.DB, next models.RefreshToken) error {
+		var user models.User
+		if err := tx.Where("id = ?", next.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		if h.blockedUnverified(user) {
+			return errEmailNotVerified
+		}
+		var err error
+		token, err = h.signToken(user, next)
+		return err
+	})
+	if errors.Is(err, auth.ErrRefreshReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Refresh token was already used; please log in again", "code": "REFRESH_TOKEN_REUSED"})
+		return
+	}
+	if errors.Is(err, auth.ErrRefreshInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid refresh token", "code": "REFRESH_TOKEN_INVALID"})
+		return
+	}
+	if errors.Is(err, errEmailNotVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Email address is not verified", "code": "EMAIL_NOT_VERIFIED"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to refresh token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"token":         token,
+			"refresh_token": refresh,
+			"expires_in":    int64(h.cfg.AccessTokenTTL.Seconds()),
 		},
 	})
 }
 
+// Logout revokes the access token it was called with and the refresh tokens
+// of the same login.
 func (h *AuthHandler) Logout(c *gin.Context) {
+	uid := uuid.MustParse(c.GetString("user_id"))
+	exp, _ := c.Get("token_expires_at")
+	expiresAt, _ := exp.(time.Time)
+	if err := h.revocations.Revoke(uid, c.GetString("token_id"), expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to log out"})
+		return
+	}
+	if sid, err := uuid.Parse(c.GetString("session_id")); err == nil {
+		if err := auth.RevokeFamily(h.db, sid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to log out"})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Logout successful"})
 }
 
-func (h *AuthHandler) signToken(userID string) string {
+// LogoutAll revokes every access and refresh token the user holds, on every
+// device, including the one making the request.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	uid := uuid.MustParse(c.GetString("user_id"))
+	if _, err := h.revocations.RevokeAll(uid); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Logged out of all sessions"})
+}
+
+// registerDevice records the device a client logged in from, bringing it
+// back if it had been revoked. It returns the device ID to bind the token to,
+// or "" when the client did not identify a device.
+func (h *AuthHandler) registerDevice(userID uuid.UUID, info *devices.Info) (string, error) {
+	if info == nil {
+		return "", nil
+	}
+	d, err := devices.Seen(h.db, userID, *info)
+	if err != nil {
+		return "", err
+	}
+	if err := devices.Reactivate(h.db, &d); err != nil {
+		return "", err
+	}
+	return d.DeviceID, nil
+}
+
+// issueTokens signs an access token and starts a new refresh token family.
+func (h *AuthHandler) issueTokens(user models.User, deviceID string) (string, string, error) {
+	refresh, rt, err := auth.IssueRefresh(h.db, user.ID, deviceID, h.cfg.RefreshTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := h.signToken(user, rt)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refresh, nil
+}
+
+// signToken signs an access token to go with refresh token rt. sid names
+// rt's family, so logout can revoke both; gen is the user's token generation
+// at issue time; auth_time is when the user logged in. Unverified users get a
+// read-only token when EMAIL_VERIFICATION is read_only.
+func (h *AuthHandler) signToken(user models.User, rt models.RefreshToken) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"user_id": user.ID.String(),
+		"jti":     uuid.NewString(),
+		"sid":     rt.FamilyID.String(),
+		"gen":     user.TokenGeneration,
+		"exp":     time.Now().Add(h.cfg.AccessTokenTTL).Unix(),
+	}
+	if user.VerifiedAt == nil && h.cfg.EmailVerification == config.VerificationReadOnly {
+		claims["ro"] = true
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	s, _ := t.SignedString([]byte(h.cfg.JWTSecret))
-	return s
+	if rt.DeviceID != "" {
+		claims["device_id"] = rt.DeviceID
+	}
+	if rt.AuthTime != nil {
+		claims["auth_time"] = rt.AuthTime.Unix()
+	}
+	return h.keys.Sign(claims)
+}
+
+// JWKS publishes the public keys access tokens are verified with.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
 }
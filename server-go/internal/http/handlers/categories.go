@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -8,18 +9,21 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/your-org/notes-api/internal/changelog"
 	"github.com/your-org/notes-api/internal/config"
 	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/realtime"
 )
 
 type CategoriesHandler struct {
 	cfg config.Config
 	db  *gorm.DB
+	hub *realtime.Hub
 	v   *validator.Validate
 }
 
-func NewCategoriesHandler(cfg config.Config, db *gorm.DB) *CategoriesHandler {
-	return &CategoriesHandler{cfg: cfg, db: db, v: validator.New()}
+func NewCategoriesHandler(cfg config.Config, db *gorm.DB, hub *realtime.Hub) *CategoriesHandler {
+	return &CategoriesHandler{cfg: cfg, db: db, hub: hub, v: validator.New()}
 }
 
 type categoryReq struct {
@@ -44,11 +48,21 @@ func (h *CategoriesHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
 		return
 	}
-	cat := models.Category{ID: uuid.New(), UserID: uuid.MustParse(userID), Name: req.Name, Color: req.Color}
-	if err := h.db.Create(&cat).Error; err != nil {
+	cat := models.Category{ID: uuid.New(), UserID: uuid.MustParse(userID), Name: req.Name, Color: req.Color, Version: 1}
+	var change models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&cat).Error; err != nil {
+			return err
+		}
+		var err error
+		change, err = changelog.Record(tx, cat.UserID, changelog.EntityCategory, cat.ID, changelog.OpCreate)
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create category"})
 		return
 	}
+	h.hub.Publish(change)
 	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Category created successfully", "data": gin.H{"category": cat}})
 }
 
@@ -60,23 +74,69 @@ func (h *CategoriesHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
 		return
 	}
-	res := h.db.Model(&models.Category{}).Where("user_id = ? AND id = ?", userID, id).Updates(map[string]interface{}{"name": req.Name, "color": req.Color})
-	if res.Error != nil || res.RowsAffected == 0 {
+	h.saveUpdate(c, userID, id, req)
+}
+
+// saveUpdate gives the category the fields of req as its next version and
+// responds with the result.
+func (h *CategoriesHandler) saveUpdate(c *gin.Context, userID, id string, req categoryReq) {
+	var cat models.Category
+	var change models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Category{}).Where("user_id = ? AND id = ?", userID, id).Updates(map[string]interface{}{"name": req.Name, "color": req.Color, "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("user_id = ? AND id = ?", userID, id).First(&cat).Error; err != nil {
+			return err
+		}
+		var err error
+		change, err = changelog.Record(tx, cat.UserID, changelog.EntityCategory, cat.ID, changelog.OpUpdate)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Category not found", "code": "CATEGORY_NOT_FOUND"})
 		return
 	}
-	var cat models.Category
-	h.db.Where("user_id = ? AND id = ?", userID, id).First(&cat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to update category"})
+		return
+	}
+	h.hub.Publish(change)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"category": cat}})
 }
 
 func (h *CategoriesHandler) Delete(c *gin.Context) {
 	userID := c.GetString("user_id")
-	id := c.Param("id")
-	res := h.db.Where("user_id = ? AND id = ?", userID, id).Delete(&models.Category{})
-	if res.Error != nil || res.RowsAffected == 0 {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Category not found", "code": "CATEGORY_NOT_FOUND"})
+		return
+	}
+	var change models.Change
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("user_id = ? AND id = ?", userID, id).Delete(&models.Category{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		var err error
+		change, err = changelog.Record(tx, uuid.MustParse(userID), changelog.EntityCategory, id, changelog.OpDelete)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Category not found", "code": "CATEGORY_NOT_FOUND"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to delete category"})
+		return
+	}
+	h.hub.Publish(change)
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Category deleted successfully"})
 }
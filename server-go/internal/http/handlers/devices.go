@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+type DevicesHandler struct {
+	cfg config.Config
+	db  *gorm.DB
+}
+
+func NewDevicesHandler(cfg config.Config, db *gorm.DB) *DevicesHandler {
+	return &DevicesHandler{cfg: cfg, db: db}
+}
+
+func (h *DevicesHandler) List(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var list []models.Device
+	if err := h.db.Where("user_id = ?", userID).Order("last_seen_at desc").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch devices"})
+		return
+	}
+	current := c.GetString("device_id")
+	out := []gin.H{}
+	for _, d := range list {
+		out = append(out, gin.H{
+			"id":           d.ID,
+			"device_id":    d.DeviceID,
+			"name":         d.Name,
+			"platform":     d.Platform,
+			"app_version":  d.AppVersion,
+			"last_seen_at": d.LastSeenAt,
+			"revoked_at":   d.RevokedAt,
+			"created_at":   d.CreatedAt,
+			"current":      d.DeviceID == current,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"devices": out}})
+}
+
+// Revoke signs a device out. Its requests are rejected with DEVICE_REVOKED
+// and its refresh tokens stop working until the user logs in on it again.
+func (h *DevicesHandler) Revoke(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var d models.Device
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND id = ? AND revoked_at IS NULL", userID, c.Param("id")).First(&d).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&d).Update("revoked_at", time.Now().UTC()).Error; err != nil {
+			return err
+		}
+		return auth.RevokeDevice(tx, d.UserID, d.DeviceID)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Device not found", "code": "DEVICE_NOT_FOUND"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to revoke device"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Device signed out successfully"})
+}
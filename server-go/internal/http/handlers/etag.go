@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// errNoteChanged means a write lost a race with another write to the same
+// note.
+var errNoteChanged = errors.New("note changed")
+
+// noteETag is the entity tag of a note: its version, which every write
+// increments.
+func noteETag(n models.Note) string {
+	return `"v` + strconv.FormatInt(n.Version, 10) + `"`
+}
+
+func setNoteETag(c *gin.Context, n models.Note) {
+	c.Header("ETag", noteETag(n))
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header names the
+// note's current ETag. If-Match needs the strong comparison, which no weak
+// tag passes; If-None-Match uses the weak one, which ignores W/.
+func etagMatches(header string, n models.Note, weak bool) bool {
+	want := noteETag(n)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified answers a conditional GET with 304 if the client's copy, named
+// by If-None-Match, is current.
+func notModified(c *gin.Context, n models.Note) bool {
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagMatches(inm, n, true) {
+		setNoteETag(c, n)
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// ifMatch checks the If-Match precondition of a write against the note as
+// read. It reports whether the client sent one, and whether the write may go
+// ahead, having responded with 412 if not. Writes pass the version they
+// read to the database, so a write landing in between is caught with
+// errNoteChanged whether or not the client sent If-Match.
+func ifMatch(c *gin.Context, n models.Note) (guarded, ok bool) {
+	im := c.GetHeader("If-Match")
+	if im == "" {
+		return false, true
+	}
+	if !etagMatches(im, n, false) {
+		preconditionFailed(c, n)
+		return true, false
+	}
+	return true, true
+}
+
+// matchedVersion checks If-Match for a write that does not otherwise read
+// the note first. If guarded, the write must be limited to the returned
+// version.
+func (h *NotesHandler) matchedVersion(c *gin.Context, userID, id string) (version int64, guarded, ok bool) {
+	if c.GetHeader("If-Match") == "" {
+		return 0, false, true
+	}
+	var note models.Note
+	if err := h.db.Where("user_id = ? AND id = ?", userID, id).First(&note).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
+		return 0, true, false
+	}
+	if _, ok := ifMatch(c, note); !ok {
+		return 0, true, false
+	}
+	return note.Version, true, true
+}
+
+// preconditionFailed responds with 412 and the server's copy of the note, so
+// the client can merge its change into it and try again.
+func preconditionFailed(c *gin.Context, n models.Note) {
+	setNoteETag(c, n)
+	c.JSON(http.StatusPreconditionFailed, gin.H{"success": false, "error": "Note has been changed by someone else", "code": "PRECONDITION_FAILED", "data": gin.H{"note": n}})
+}
+
+// noteChanged responds to a write that lost a race: with the note as it is
+// now, as 412 if the write was guarded by If-Match and 409 if not, or 404 if
+// the note has since been deleted.
+func (h *NotesHandler) noteChanged(c *gin.Context, userID, id string, guarded bool) {
+	var note models.Note
+	err := h.db.Where("user_id = ? AND id = ?", userID, id).First(&note).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch note"})
+		return
+	}
+	if guarded {
+		preconditionFailed(c, note)
+		return
+	}
+	setNoteETag(c, note)
+	c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Note was changed by another request at the same time", "code": "NOTE_CONFLICT", "data": gin.H{"note": note}})
+}
+
+// writeNote writes a changed note that was read at version prev. The write
+// only applies if the stored note is still at prev, and fails with
+// errNoteChanged if not, so that of two writes from the same version one
+// loses cleanly instead of colliding on the revision it saves.
+func writeNote(tx *gorm.DB, note *models.Note, prev int64) error {
+	res := tx.Model(note).Where("version = ?", prev).Select("*").Updates(note)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errNoteChanged
+	}
+	return nil
+}
@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -9,17 +10,21 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/your-org/notes-api/internal/changelog"
 	"github.com/your-org/notes-api/internal/config"
 	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/realtime"
 )
 
 type NotesHandler struct {
-	cfg config.Config
-	db  *gorm.DB
+	cfg       config.Config
+	db        *gorm.DB
+	hub       *realtime.Hub
+	revisions revisionLog
 }
 
-func NewNotesHandler(cfg config.Config, db *gorm.DB) *NotesHandler {
-	return &NotesHandler{cfg: cfg, db: db}
+func NewNotesHandler(cfg config.Config, db *gorm.DB, hub *realtime.Hub) *NotesHandler {
+	return &NotesHandler{cfg: cfg, db: db, hub: hub, revisions: newRevisionLog(cfg)}
 }
 
 type noteReq struct {
@@ -27,33 +32,50 @@ type noteReq struct {
 	Content  string   `json:"content"`
 	Category *string  `json:"category"`
 	Tags     []string `json:"tags"`
+	// Pinned and Position are left as they are when omitted.
+	Pinned   *bool `json:"pinned"`
+	Position *int  `json:"position"`
+}
+
+// noteSorts maps the sort parameter of List to a column and its default
+// direction, which the order parameter overrides.
+var noteSorts = map[string]struct{ column, order string }{
+	"title":      {"title", "asc"},
+	"created_at": {"created_at", "desc"},
+	"updated_at": {"updated_at", "desc"},
+	"position":   {"position", "asc"},
 }
 
 func (h *NotesHandler) List(c *gin.Context) {
-	userID := c.GetString("user_id")
-	var notes []models.Note
-	q := h.db.Where("user_id = ?", userID)
-	if s := c.Query("search"); s != "" {
-		like := "%" + strings.ToLower(s) + "%"
-		q = q.Where("LOWER(title) LIKE ? OR LOWER(content) LIKE ?", like, like)
+	page, ok := queryInt(c, "page", 1, 1, 1<<20)
+	if !ok {
+		return
 	}
-	if c.Query("archived") == "true" {
-		q = q.Where("archived = 1")
-	} else {
-		q = q.Where("archived = 0")
+	limit, ok := queryInt(c, "limit", 20, 1, 100)
+	if !ok {
+		return
 	}
-	var total int64
-	q.Model(&models.Note{}).Count(&total)
-	page := 1
-	limit := 20
-	if v := c.Query("page"); v != "" {
-		fmt.Sscanf(v, "%d", &page)
+	sort, ok := noteSorts[c.DefaultQuery("sort", "updated_at")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR", "details": gin.H{"sort": "Must be title, created_at, updated_at or position"}})
+		return
 	}
-	if v := c.Query("limit"); v != "" {
-		fmt.Sscanf(v, "%d", &limit)
+	order := c.DefaultQuery("order", sort.order)
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR", "details": gin.H{"order": "Must be asc or desc"}})
+		return
+	}
+	q, ok := h.filterNotes(c)
+	if !ok {
+		return
 	}
-	offset := (page - 1) * limit
-	if err := q.Limit(limit).Offset(offset).Order("updated_at desc").Find(&notes).Error; err != nil {
+	var total int64
+	var notes []models.Note
+	err := q.Model(&models.Note{}).Count(&total).Error
+	if err == nil {
+		err = q.Order(sort.column + " " + order).Order("id").Limit(limit).Offset((page - 1) * limit).Find(&notes).Error
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch notes"})
 		return
 	}
@@ -68,6 +90,79 @@ func (h *NotesHandler) List(c *gin.Context) {
 	}})
 }
 
+// filterNotes turns the filter parameters of List into a query.
+func (h *NotesHandler) filterNotes(c *gin.Context) (*gorm.DB, bool) {
+	q := h.db.Where("user_id = ?", c.GetString("user_id"))
+	if s := c.Query("search"); s != "" {
+		like := "%" + strings.ToLower(s) + "%"
+		q = q.Where("LOWER(title) LIKE ? OR LOWER(content) LIKE ?", like, like)
+	}
+	archived, ok := queryBool(c, "archived")
+	if !ok {
+		return nil, false
+	}
+	q = q.Where("archived = ?", archived != nil && *archived)
+	if cat := c.Query("category"); cat != "" {
+		q = q.Where("category = ?", cat)
+	}
+	var tags []string
+	for _, t := range strings.Split(c.Query("tags"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	switch match := c.DefaultQuery("tags_match", "any"); {
+	case match != "any" && match != "all":
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR", "details": gin.H{"tags_match": "Must be any or all"}})
+		return nil, false
+	case len(tags) == 0:
+	case match == "all":
+		all, _ := json.Marshal(tags)
+		q = q.Where("JSON_CONTAINS(tags, ?)", string(all))
+	default:
+		conds := make([]string, len(tags))
+		args := make([]interface{}, len(tags))
+		for i, t := range tags {
+			b, _ := json.Marshal(t)
+			conds[i], args[i] = "JSON_CONTAINS(tags, ?)", string(b)
+		}
+		q = q.Where(strings.Join(conds, " OR "), args...)
+	}
+	for _, r := range []struct{ param, cond string }{
+		{"created_after", "created_at >= ?"},
+		{"created_before", "created_at < ?"},
+		{"updated_after", "updated_at >= ?"},
+		{"updated_before", "updated_at < ?"},
+	} {
+		t, ok := queryTime(c, r.param)
+		if !ok {
+			return nil, false
+		}
+		if t != nil {
+			q = q.Where(r.cond, *t)
+		}
+	}
+	hasAttachments, ok := queryBool(c, "has_attachments")
+	if !ok {
+		return nil, false
+	}
+	if hasAttachments != nil {
+		exists := "EXISTS (SELECT 1 FROM attachments WHERE attachments.note_id = notes.id)"
+		if !*hasAttachments {
+			exists = "NOT " + exists
+		}
+		q = q.Where(exists)
+	}
+	pinned, ok := queryBool(c, "pinned")
+	if !ok {
+		return nil, false
+	}
+	if pinned != nil {
+		q = q.Where("pinned = ?", *pinned)
+	}
+	return q, true
+}
+
 func (h *NotesHandler) Get(c *gin.Context) {
 	userID := c.GetString("user_id")
 	id := c.Param("id")
@@ -76,6 +171,10 @@ func (h *NotesHandler) Get(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
 		return
 	}
+	if notModified(c, note) {
+		return
+	}
+	setNoteETag(c, note)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"note": note}})
 }
 
@@ -103,11 +202,32 @@ func (h *NotesHandler) Create(c *gin.Context) {
 		Category: req.Category,
 		Tags:     append([]string{}, req.Tags...),
 		Archived: false,
+		Version:  1,
+	}
+	if req.Pinned != nil {
+		note.Pinned = *req.Pinned
 	}
-	if err := h.db.Create(&note).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": fmt.Sprintf("Failed to create note: %v", err)})
+	if req.Position != nil {
+		note.Position = *req.Position
+	}
+	var change models.Change
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		if err := h.revisions.save(tx, note, authorOf(c)); err != nil {
+			return err
+		}
+		var err error
+		change, err = changelog.Record(tx, uid, changelog.EntityNote, note.ID, changelog.OpCreate)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create note"})
 		return
 	}
+	h.hub.Publish(change)
+	setNoteETag(c, note)
 	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Note created successfully", "data": gin.H{"note": note}})
 }
 
@@ -123,29 +243,102 @@ func (h *NotesHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
 		return
 	}
+	guarded, ok := ifMatch(c, note)
+	if !ok {
+		return
+	}
 	var req noteReq
 	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Title) == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR", "details": gin.H{"title": "Title cannot be empty"}})
 		return
 	}
+	h.saveUpdate(c, note, req, guarded)
+}
+
+// saveUpdate gives note the fields of req as its next version and responds
+// with the result.
+func (h *NotesHandler) saveUpdate(c *gin.Context, note models.Note, req noteReq, guarded bool) {
+	prev := note.Version
 	note.Title = req.Title
 	note.Content = req.Content
 	note.Category = req.Category
 	note.Tags = append([]string{}, req.Tags...)
-	if err := h.db.Save(&note).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": fmt.Sprintf("Failed to update note: %v", err)})
+	if req.Pinned != nil {
+		note.Pinned = *req.Pinned
+	}
+	if req.Position != nil {
+		note.Position = *req.Position
+	}
+	note.Version++
+	var change models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := writeNote(tx, &note, prev); err != nil {
+			return err
+		}
+		if err := h.revisions.save(tx, note, authorOf(c)); err != nil {
+			return err
+		}
+		var err error
+		change, err = changelog.Record(tx, note.UserID, changelog.EntityNote, note.ID, changelog.OpUpdate)
+		return err
+	})
+	if errors.Is(err, errNoteChanged) {
+		h.noteChanged(c, note.UserID.String(), note.ID.String(), guarded)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to update note"})
 		return
 	}
+	h.hub.Publish(change)
+	setNoteETag(c, note)
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Note updated successfully", "data": gin.H{"note": note}})
 }
 
 func (h *NotesHandler) Delete(c *gin.Context) {
 	userID := c.GetString("user_id")
-	id := c.Param("id")
-	if err := h.db.Where("user_id = ? AND id = ?", userID, id).Delete(&models.Note{}).Error; err != nil {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
+		return
+	}
+	version, guarded, ok := h.matchedVersion(c, userID, id.String())
+	if !ok {
+		return
+	}
+	var change models.Change
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		q := tx.Where("user_id = ? AND id = ?", userID, id)
+		if guarded {
+			q = q.Where("version = ?", version)
+		}
+		res := q.Delete(&models.Note{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 && guarded {
+			return errNoteChanged
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		var err error
+		change, err = changelog.Record(tx, uuid.MustParse(userID), changelog.EntityNote, id, changelog.OpDelete)
+		return err
+	})
+	if errors.Is(err, errNoteChanged) {
+		h.noteChanged(c, userID, id.String(), true)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to delete note"})
 		return
 	}
+	h.hub.Publish(change)
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Note deleted successfully"})
 }
 
@@ -159,12 +352,48 @@ func (h *NotesHandler) Archive(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
 		return
 	}
-	if err := h.db.Model(&models.Note{}).Where("user_id = ? AND id = ?", userID, id).Update("archived", payload.Archived).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to archive note"})
+	version, guarded, ok := h.matchedVersion(c, userID, id)
+	if !ok {
 		return
 	}
 	var note models.Note
-	h.db.Where("user_id = ? AND id = ?", userID, id).First(&note)
+	var change models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		q := tx.Model(&models.Note{}).Where("user_id = ? AND id = ?", userID, id)
+		if guarded {
+			q = q.Where("version = ?", version)
+		}
+		res := q.Updates(map[string]interface{}{"archived": payload.Archived, "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return res.Error
+		}
+		if guarded && res.RowsAffected == 0 {
+			return errNoteChanged
+		}
+		if err := tx.Where("user_id = ? AND id = ?", userID, id).First(&note).Error; err != nil {
+			return err
+		}
+		if err := h.revisions.save(tx, note, authorOf(c)); err != nil {
+			return err
+		}
+		var err error
+		change, err = changelog.Record(tx, note.UserID, changelog.EntityNote, note.ID, changelog.OpUpdate)
+		return err
+	})
+	if errors.Is(err, errNoteChanged) {
+		h.noteChanged(c, userID, id, true)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to archive note"})
+		return
+	}
+	h.hub.Publish(change)
+	setNoteETag(c, note)
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Note archived successfully", "data": gin.H{"note": note}})
 }
 
@@ -177,10 +406,36 @@ func (h *NotesHandler) BulkDelete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request", "code": "VALIDATION_ERROR"})
 		return
 	}
-	res := h.db.Where("user_id = ? AND id IN ?", userID, payload.NoteIDs).Delete(&models.Note{})
+	var deleted int64
+	var changes []models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uuid.UUID
+		if err := tx.Model(&models.Note{}).Where("user_id = ? AND id IN ?", userID, payload.NoteIDs).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		res := tx.Where("user_id = ? AND id IN ?", userID, ids).Delete(&models.Note{})
+		if res.Error != nil {
+			return res.Error
+		}
+		deleted = res.RowsAffected
+		for _, id := range ids {
+			change, err := changelog.Record(tx, uuid.MustParse(userID), changelog.EntityNote, id, changelog.OpDelete)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
 	failed := []string{}
-	if res.Error != nil {
+	if err != nil {
+		deleted = 0
 		failed = payload.NoteIDs
+	} else {
+		h.hub.Publish(changes...)
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "bulk delete", "data": gin.H{"deleted_count": res.RowsAffected, "failed_ids": failed}})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "bulk delete", "data": gin.H{"deleted_count": deleted, "failed_ids": failed}})
 }
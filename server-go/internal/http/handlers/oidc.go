@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/devices"
+	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/oidc"
+)
+
+// oidcLoginTTL is how long a user has to finish signing in at the issuer.
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	errOIDCEmailConflict = errors.New("oidc: email belongs to an account that cannot be linked")
+	errOIDCNoEmail       = errors.New("oidc: identity has no email")
+)
+
+// OIDCProviders lists the external identity providers users can log in with.
+func (h *AuthHandler) OIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"providers": h.oidc.Names()}})
+}
+
+// OIDCStart begins a login at an external issuer and returns the URL to send
+// the user's browser to. State, nonce and the PKCE verifier stay on the
+// server; only the state and the PKCE challenge travel through the browser.
+func (h *AuthHandler) OIDCStart(c *gin.Context) {
+	p, ok := h.oidc.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Unknown identity provider", "code": "OIDC_PROVIDER_NOT_FOUND"})
+		return
+	}
+	var req struct {
+		Device *devices.Info `json:"device"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil || (req.Device != nil && h.v.Struct(req.Device) != nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request", "code": "VALIDATION_ERROR"})
+			return
+		}
+	}
+	state, err := oidc.NewState()
+	var nonce, verifier, challenge string
+	if err == nil {
+		nonce, err = oidc.NewState()
+	}
+	if err == nil {
+		verifier, challenge, err = oidc.NewPKCE()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to start login"})
+		return
+	}
+	authURL, err := p.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": "Identity provider is unavailable", "code": "OIDC_FAILED"})
+		return
+	}
+	login := models.OIDCLogin{
+		StateHash:    auth.HashToken(state),
+		Provider:     c.Param("provider"),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginTTL),
+	}
+	if req.Device != nil {
+		b, _ := json.Marshal(req.Device)
+		login.Device = string(b)
+	}
+	if err := h.db.Where("expires_at < ?", time.Now().UTC()).Delete(&models.OIDCLogin{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to start login"})
+		return
+	}
+	if err := h.db.Create(&login).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to start login"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"authorization_url": authURL,
+		"state":             state,
+		"expires_in":        int64(oidcLoginTTL.Seconds()),
+	}})
+}
+
+// OIDCCallback finishes an external login. The issuer redirects the browser
+// here with code and state in the query; apps that catch the redirect
+// themselves can POST the same fields as JSON instead. The response is the
+// same as for a password login.
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	var req struct {
+		Code             string `json:"code" form:"code"`
+		State            string `json:"state" form:"state"`
+		Error            string `json:"error" form:"error"`
+		ErrorDescription string `json:"error_description" form:"error_description"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request", "code": "VALIDATION_ERROR"})
+		return
+	}
+	if req.Error != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Identity provider refused the login: " + strings.TrimSpace(req.Error+" "+req.ErrorDescription), "code": "OIDC_FAILED"})
+		return
+	}
+	if req.Code == "" || req.State == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Code and state are required", "code": "VALIDATION_ERROR"})
+		return
+	}
+	p, ok := h.oidc.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Unknown identity provider", "code": "OIDC_PROVIDER_NOT_FOUND"})
+		return
+	}
+	// The state is single-use: delete it before doing anything with it.
+	var login models.OIDCLogin
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ? AND provider = ?", auth.HashToken(req.State), c.Param("provider")).First(&login).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&login).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && time.Now().After(login.ExpiresAt)) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Login session is invalid or has expired; start again", "code": "OIDC_STATE_INVALID"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to complete login"})
+		return
+	}
+	claims, err := p.Exchange(c.Request.Context(), req.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Could not verify the identity provider's response", "code": "OIDC_FAILED"})
+		return
+	}
+	user, err := h.oidcUser(login.Provider, claims)
+	if errors.Is(err, errOIDCEmailConflict) {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "An account with this email exists, but the provider has not verified the address; log in with your password instead", "code": "OIDC_EMAIL_CONFLICT"})
+		return
+	}
+	if errors.Is(err, errOIDCNoEmail) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "The identity provider did not share an email address", "code": "OIDC_FAILED"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to complete login"})
+		return
+	}
+	if h.blockedUnverified(user) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Email address is not verified", "code": "EMAIL_NOT_VERIFIED"})
+		return
+	}
+	var info *devices.Info
+	if login.Device != "" {
+		info = &devices.Info{}
+		if json.Unmarshal([]byte(login.Device), info) != nil {
+			info = nil
+		}
+	}
+	if user.TOTPEnabledAt != nil {
+		h.challenge(c, user, info)
+		return
+	}
+	h.completeLogin(c, user, info)
+}
+
+// oidcUser finds the user an external identity belongs to. An identity seen
+// before maps to its user. Otherwise it is linked to the user with the same
+// email, but only if the issuer verified that address; without any such
+// user, a new one is created without a password.
+func (h *AuthHandler) oidcUser(provider string, claims oidc.Claims) (models.User, error) {
+	var user models.User
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var ident models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", claims.Issuer, claims.Subject).First(&ident).Error
+		if err == nil {
+			return tx.Where("id = ?", ident.UserID).First(&user).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if claims.Email == "" {
+			return errOIDCNoEmail
+		}
+		now := time.Now().UTC()
+		err = tx.Where("email = ?", claims.Email).First(&user).Error
+		switch {
+		case err == nil && !claims.EmailVerified:
+			return errOIDCEmailConflict
+		case err == nil:
+			if user.VerifiedAt == nil {
+				user.VerifiedAt = &now
+				if err := tx.Model(&user).Update("verified_at", now).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = models.User{ID: uuid.New(), Name: oidcDisplayName(claims), Email: claims.Email}
+			if claims.EmailVerified {
+				user.VerifiedAt = &now
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+		return tx.Create(&models.UserIdentity{
+			ID:       uuid.New(),
+			UserID:   user.ID,
+			Provider: provider,
+			Issuer:   claims.Issuer,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}).Error
+	})
+	return user, err
+}
+
+func oidcDisplayName(claims oidc.Claims) string {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	if r := []rune(name); len(r) > 100 {
+		name = string(r[:100])
+	}
+	return name
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/dbtest"
+	"github.com/your-org/notes-api/internal/oidc"
+	"github.com/your-org/notes-api/internal/oidc/oidctest"
+)
+
+// TestOIDCCallback runs the code flow with PKCE against the mock issuer and
+// checks how the callback treats the state, the nonce and an existing
+// account with the same email.
+func TestOIDCCallback(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := oidctest.NewIssuer("", key)
+	srv := httptest.NewServer(iss)
+	defer srv.Close()
+	iss.URL = srv.URL
+	providers := oidc.NewRegistry([]config.OIDCProvider{{
+		Name: "mock", Issuer: srv.URL, ClientID: "notes", RedirectURL: "http://app.test/callback", Scopes: []string{"openid", "email"},
+	}}, srv.Client())
+	cfg := config.Config{AppEnv: "dev", JWTAlgorithm: "HS256", JWTSecret: "test-secret", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}
+	keys, err := auth.LoadKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		wrongState  bool
+		wrongNonce  bool
+		verified    bool
+		status      int
+		code        string
+		linksToUser bool
+	}{
+		{name: "unknown state", wrongState: true, verified: true, status: http.StatusBadRequest, code: "OIDC_STATE_INVALID"},
+		{name: "nonce mismatch", wrongNonce: true, verified: true, status: http.StatusUnauthorized, code: "OIDC_FAILED"},
+		{name: "links to the user with the verified email", verified: true, status: http.StatusOK, linksToUser: true},
+		{name: "refuses an unverified email", status: http.StatusConflict, code: "OIDC_EMAIL_CONFLICT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss.Verified = tt.verified
+			p, _ := providers.Get("mock")
+			state, nonce := "state-"+uuid.NewString(), "nonce-"+uuid.NewString()
+			verifier, challenge, _ := oidc.NewPKCE()
+			authURL, err := p.AuthCodeURL(context.Background(), state, nonce, challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+			res, err := noRedirect.Get(authURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			back, _ := url.Parse(res.Header.Get("Location"))
+
+			stored := nonce
+			if tt.wrongNonce {
+				stored = "nonce-of-another-login"
+			}
+			userID := uuid.New()
+			var linkedTo []driver.Value
+			db := dbtest.Open(t, func(query string, args []driver.Value) dbtest.Result {
+				switch {
+				case dbtest.Match(query, "SELECT * FROM o_id_c_logins"):
+					if args[0] != auth.HashToken(state) {
+						return dbtest.Result{}
+					}
+					return dbtest.Result{
+						Columns: []string{"state_hash", "provider", "nonce", "code_verifier", "expires_at"},
+						Rows:    [][]driver.Value{{auth.HashToken(state), "mock", stored, verifier, time.Now().Add(time.Minute)}},
+					}
+				case dbtest.Match(query, "SELECT * FROM users") && strings.Contains(query, "email = ?"):
+					return dbtest.Result{
+						Columns: []string{"id", "email", "name", "verified_at"},
+						Rows:    [][]driver.Value{{userID.String(), "dev@example.com", "Existing", time.Now()}},
+					}
+				case dbtest.Match(query, "INSERT INTO user_identities"):
+					linkedTo = args
+				case dbtest.Match(query, "DELETE"):
+					return dbtest.Result{RowsAffected: 1}
+				}
+				return dbtest.Result{}
+			})
+			h := NewAuthHandler(cfg, db, keys, nil, nil, providers, nil, nil, nil)
+
+			q := back.Query()
+			if tt.wrongState {
+				q.Set("state", "state-of-another-login")
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/mock/callback?"+q.Encode(), nil)
+			c.Params = gin.Params{{Key: "provider", Value: "mock"}}
+			h.OIDCCallback(c)
+
+			var body struct{ Code string }
+			_ = json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != tt.status || body.Code != tt.code {
+				t.Fatalf("callback = %d %s, want %d %s; body %s", w.Code, body.Code, tt.status, tt.code, w.Body)
+			}
+			linked := false
+			for _, a := range linkedTo {
+				linked = linked || a == userID.String()
+			}
+			if linked != tt.linksToUser {
+				t.Errorf("identity linked to the existing user = %v, want %v", linked, tt.linksToUser)
+			}
+		})
+	}
+}
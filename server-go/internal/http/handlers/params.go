@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryInt reads an optional integer query parameter that must lie within
+// [min, max]. On a bad value it responds with VALIDATION_ERROR and reports
+// false.
+func queryInt(c *gin.Context, name string, def, min, max int) (int, bool) {
+	v, present := c.GetQuery(name)
+	if !present || v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR",
+			"details": gin.H{name: fmt.Sprintf("Must be an integer from %d to %d", min, max)}})
+		return 0, false
+	}
+	return n, true
+}
+
+// queryBool reads an optional boolean query parameter. It returns nil if the
+// parameter is absent.
+func queryBool(c *gin.Context, name string) (*bool, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, true
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR",
+			"details": gin.H{name: "Must be true or false"}})
+		return nil, false
+	}
+	return &b, true
+}
+
+// queryTime reads an optional timestamp query parameter, given in RFC 3339
+// or as a date, which means midnight UTC. It returns nil if the parameter
+// is absent.
+func queryTime(c *gin.Context, name string) (*time.Time, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", v)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR",
+			"details": gin.H{name: "Must be an RFC 3339 timestamp or a YYYY-MM-DD date"}})
+		return nil, false
+	}
+	return &t, true
+}
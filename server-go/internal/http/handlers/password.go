@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/mailer"
+	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/password"
+)
+
+type forgotPasswordReq struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type resetPasswordReq struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// weakPassword rejects a new password the policy does not allow. It reports
+// whether it has responded.
+func (h *AuthHandler) weakPassword(c *gin.Context, pw string) bool {
+	err := h.policy.Check(pw)
+	if err == nil {
+		return false
+	}
+	msg := "Password has appeared in a data breach; choose another"
+	switch {
+	case errors.Is(err, password.ErrTooShort):
+		msg = fmt.Sprintf("Password must be at least %d characters", h.policy.MinLength)
+	case errors.Is(err, password.ErrTooLong):
+		msg = "Password is too long"
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": msg, "code": "WEAK_PASSWORD"})
+	return true
+}
+
+// ForgotPassword emails a password reset link. It answers the same way
+// whether or not the address has an account, so it cannot be used to find
+// out who is registered.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil || h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	// Failures are logged rather than returned: an error only an existing
+	// account can cause would tell the caller the address is registered.
+	var user models.User
+	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err == nil {
+		if err := h.sendPasswordReset(user); err != nil {
+			log.Printf("password reset for user %s: %v", user.ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "If the address is registered, a reset link has been sent"})
+}
+
+// sendPasswordReset emails the user a link and code to reset their password.
+func (h *AuthHandler) sendPasswordReset(user models.User) error {
+	token, err := auth.IssueOneTime(h.db, user.ID, auth.PurposePasswordReset, h.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	link := h.cfg.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	return h.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password:\n\n%s\n\nOr enter this code in the app: %s\n\nThe link expires in %s and works once. If you did not ask for it, you can ignore this email.\n",
+			user.Name, link, token, h.cfg.PasswordResetTTL),
+	})
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and
+// signs the user out everywhere. Personal access tokens are revoked too, in
+// case whoever knew the old password made some.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil || h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	if h.weakPassword(c, req.Password) {
+		return
+	}
+	hash, err := h.passwords.Hash(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to reset password"})
+		return
+	}
+	var t models.OneTimeToken
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if t, err = auth.ConsumeOneTime(tx, req.Token, auth.PurposePasswordReset); err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", t.UserID).Update("password_hash", hash).Error
+	})
+	if errors.Is(err, auth.ErrOneTimeInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Reset link is invalid or has expired", "code": "RESET_TOKEN_INVALID"})
+		return
+	}
+	if err == nil {
+		_, err = h.revocations.RevokeAll(t.UserID)
+	}
+	if err == nil {
+		err = auth.RevokePATs(h.db, t.UserID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to reset password"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Password has been reset"})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/patch"
+)
+
+// Patch changes only the fields named in a merge patch, or applies a JSON
+// Patch, such as adding or removing a single tag. The result is validated
+// like a full update.
+func (h *NotesHandler) Patch(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var note models.Note
+	if err := h.db.Where("user_id = ? AND id = ?", userID, c.Param("id")).First(&note).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
+		return
+	}
+	guarded, ok := ifMatch(c, note)
+	if !ok {
+		return
+	}
+	current := noteReq{
+		Title:    note.Title,
+		Content:  note.Content,
+		Category: note.Category,
+		Tags:     append([]string{}, note.Tags...),
+		Pinned:   &note.Pinned,
+		Position: &note.Position,
+	}
+	var req noteReq
+	if !patchDoc(c, current, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR", "details": gin.H{"title": "Title cannot be empty"}})
+		return
+	}
+	// A patch that changes nothing does not make a new version.
+	unchanged := req.Title == note.Title && req.Content == note.Content && equalStringPtr(req.Category, note.Category) && equalStrings(req.Tags, note.Tags) &&
+		(req.Pinned == nil || *req.Pinned == note.Pinned) && (req.Position == nil || *req.Position == note.Position)
+	if unchanged {
+		setNoteETag(c, note)
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "Note updated successfully", "data": gin.H{"note": note}})
+		return
+	}
+	h.saveUpdate(c, note, req, guarded)
+}
+
+// Patch changes only the fields named in the patch.
+func (h *CategoriesHandler) Patch(c *gin.Context) {
+	userID := c.GetString("user_id")
+	id := c.Param("id")
+	var cat models.Category
+	err := h.db.Where("user_id = ? AND id = ?", userID, id).First(&cat).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Category not found", "code": "CATEGORY_NOT_FOUND"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch category"})
+		return
+	}
+	var req categoryReq
+	if !patchDoc(c, categoryReq{Name: cat.Name, Color: cat.Color}, &req) {
+		return
+	}
+	if h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	// As with notes, a patch that changes nothing does not make a new
+	// version.
+	if req.Name == cat.Name && equalStringPtr(req.Color, cat.Color) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"category": cat}})
+		return
+	}
+	h.saveUpdate(c, userID, id, req)
+}
+
+// patchDoc applies the request body to current, as a merge patch or a JSON
+// Patch depending on Content-Type, and decodes the result into out. Fields
+// the patch adds that out does not have are an error. It reports whether
+// the patch applied, having responded if not.
+func patchDoc(c *gin.Context, current, out interface{}) bool {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to apply patch"})
+		return false
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request", "code": "VALIDATION_ERROR"})
+		return false
+	}
+	patched, err := patch.Apply(c.ContentType(), doc, body)
+	if err == nil {
+		d := json.NewDecoder(bytes.NewReader(patched))
+		d.DisallowUnknownFields()
+		err = d.Decode(out)
+	}
+	switch {
+	case errors.Is(err, patch.ErrUnsupportedType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"success": false, "error": "Send a merge patch (" + patch.MergePatchType + ") or JSON Patch (" + patch.JSONPatchType + ")", "code": "UNSUPPORTED_MEDIA_TYPE"})
+		return false
+	case errors.Is(err, patch.ErrTestFailed):
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "A test operation in the patch did not match", "code": "PATCH_TEST_FAILED"})
+		return false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR", "details": gin.H{"patch": err.Error()}})
+		return false
+	}
+	return true
+}
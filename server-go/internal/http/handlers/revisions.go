@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/changelog"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/merge"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// revisionLog records note revisions and prunes them according to
+// NOTE_REVISIONS_KEEP and NOTE_REVISIONS_MAX_AGE.
+type revisionLog struct {
+	keep   int
+	maxAge time.Duration
+}
+
+func newRevisionLog(cfg config.Config) revisionLog {
+	return revisionLog{keep: cfg.NoteRevisionsKeep, maxAge: cfg.NoteRevisionsMaxAge}
+}
+
+// revisionAuthor is who made a write and from which device.
+type revisionAuthor struct {
+	userID   uuid.UUID
+	deviceID string
+}
+
+func authorOf(c *gin.Context) revisionAuthor {
+	uid, _ := uuid.Parse(c.GetString("user_id"))
+	return revisionAuthor{userID: uid, deviceID: c.GetString("device_id")}
+}
+
+// save snapshots note at its current version and drops revisions that fall
+// outside the retention limits. It must run in the same transaction as the
+// write that produced that version. The newest revision is always kept.
+func (r revisionLog) save(tx *gorm.DB, note models.Note, by revisionAuthor) error {
+	return r.saveRestore(tx, note, by, nil)
+}
+
+func (r revisionLog) saveRestore(tx *gorm.DB, note models.Note, by revisionAuthor, restoredFrom *int64) error {
+	rev := models.NoteRevision{
+		ID:           uuid.New(),
+		NoteID:       note.ID,
+		UserID:       note.UserID,
+		Version:      note.Version,
+		Title:        note.Title,
+		Content:      note.Content,
+		Category:     note.Category,
+		Tags:         append([]string{}, note.Tags...),
+		Archived:     note.Archived,
+		Pinned:       note.Pinned,
+		Position:     note.Position,
+		DeviceID:     by.deviceID,
+		RestoredFrom: restoredFrom,
+	}
+	if by.userID != uuid.Nil {
+		rev.AuthorID = &by.userID
+	}
+	if err := tx.Create(&rev).Error; err != nil {
+		return err
+	}
+	if r.keep > 0 {
+		var cutoff []int64
+		if err := tx.Model(&models.NoteRevision{}).Where("note_id = ?", note.ID).Order("version desc").Offset(r.keep-1).Limit(1).Pluck("version", &cutoff).Error; err != nil {
+			return err
+		}
+		if len(cutoff) > 0 {
+			if err := tx.Where("note_id = ? AND version < ?", note.ID, cutoff[0]).Delete(&models.NoteRevision{}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	if r.maxAge > 0 {
+		return tx.Where("note_id = ? AND version < ? AND created_at < ?", note.ID, note.Version, time.Now().Add(-r.maxAge)).Delete(&models.NoteRevision{}).Error
+	}
+	return nil
+}
+
+func revisionSummary(rev models.NoteRevision) gin.H {
+	return gin.H{
+		"version":       rev.Version,
+		"title":         rev.Title,
+		"author_id":     rev.AuthorID,
+		"device_id":     rev.DeviceID,
+		"restored_from": rev.RestoredFrom,
+		"created_at":    rev.CreatedAt,
+	}
+}
+
+// Revisions lists a note's revisions, newest first, without their content.
+func (h *NotesHandler) Revisions(c *gin.Context) {
+	note, found := h.findNote(c)
+	if !found {
+		return
+	}
+	page, ok := queryInt(c, "page", 1, 1, 1<<20)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", 20, 1, 100)
+	if !ok {
+		return
+	}
+	var total int64
+	var revs []models.NoteRevision
+	q := h.db.Model(&models.NoteRevision{}).Where("note_id = ?", note.ID)
+	err := q.Count(&total).Error
+	if err == nil {
+		err = q.Order("version desc").Limit(limit).Offset((page - 1) * limit).Find(&revs).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch revisions"})
+		return
+	}
+	list := make([]gin.H, 0, len(revs))
+	for _, rev := range revs {
+		list = append(list, revisionSummary(rev))
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"revisions":       list,
+		"current_version": note.Version,
+		"pagination": gin.H{
+			"current_page":   page,
+			"total_pages":    (total + int64(limit) - 1) / int64(limit),
+			"total_items":    total,
+			"items_per_page": limit,
+		},
+	}})
+}
+
+// Revision returns the full snapshot of one revision.
+func (h *NotesHandler) Revision(c *gin.Context) {
+	note, found := h.findNote(c)
+	if !found {
+		return
+	}
+	rev, found := h.findRevision(c, note, c.Param("version"))
+	if !found {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"revision": rev}})
+}
+
+// DiffRevisions compares two revisions: line diffs of title and content,
+// and the old and new values of any other field that changed. to defaults
+// to the current version.
+func (h *NotesHandler) DiffRevisions(c *gin.Context) {
+	note, found := h.findNote(c)
+	if !found {
+		return
+	}
+	toParam := c.DefaultQuery("to", strconv.FormatInt(note.Version, 10))
+	if c.Query("from") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR", "details": gin.H{"from": "Required"}})
+		return
+	}
+	from, found := h.findRevision(c, note, c.Query("from"))
+	if !found {
+		return
+	}
+	to, found := h.findRevision(c, note, toParam)
+	if !found {
+		return
+	}
+	fields := gin.H{}
+	if !equalStringPtr(from.Category, to.Category) {
+		fields["category"] = gin.H{"from": from.Category, "to": to.Category}
+	}
+	if !equalStrings(from.Tags, to.Tags) {
+		fields["tags"] = gin.H{"from": from.Tags, "to": to.Tags}
+	}
+	if from.Archived != to.Archived {
+		fields["archived"] = gin.H{"from": from.Archived, "to": to.Archived}
+	}
+	if from.Pinned != to.Pinned {
+		fields["pinned"] = gin.H{"from": from.Pinned, "to": to.Pinned}
+	}
+	if from.Position != to.Position {
+		fields["position"] = gin.H{"from": from.Position, "to": to.Position}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"from":    from.Version,
+		"to":      to.Version,
+		"title":   merge.Diff(from.Title, to.Title),
+		"content": merge.Diff(from.Content, to.Content),
+		"fields":  fields,
+	}})
+}
+
+// RestoreRevision makes a revision's title, content, category, tags, pin
+// and position the note's current state. This is a new write, with a new
+// version and revision; the revisions in between are kept. Archiving is left
+// alone. Like PUT, it honours If-Match.
+func (h *NotesHandler) RestoreRevision(c *gin.Context) {
+	note, found := h.findNote(c)
+	if !found {
+		return
+	}
+	guarded, ok := ifMatch(c, note)
+	if !ok {
+		return
+	}
+	rev, found := h.findRevision(c, note, c.Param("version"))
+	if !found {
+		return
+	}
+	prev := note.Version
+	note.Title = rev.Title
+	note.Content = rev.Content
+	note.Category = rev.Category
+	note.Tags = append([]string{}, rev.Tags...)
+	note.Pinned = rev.Pinned
+	note.Position = rev.Position
+	note.Version++
+	var change models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := writeNote(tx, &note, prev); err != nil {
+			return err
+		}
+		if err := h.revisions.saveRestore(tx, note, authorOf(c), &rev.Version); err != nil {
+			return err
+		}
+		var err error
+		change, err = changelog.Record(tx, note.UserID, changelog.EntityNote, note.ID, changelog.OpUpdate)
+		return err
+	})
+	if errors.Is(err, errNoteChanged) {
+		h.noteChanged(c, note.UserID.String(), note.ID.String(), guarded)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to restore note"})
+		return
+	}
+	h.hub.Publish(change)
+	setNoteETag(c, note)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Note restored to version " + strconv.FormatInt(rev.Version, 10), "data": gin.H{"note": note}})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *NotesHandler) findNote(c *gin.Context) (models.Note, bool) {
+	var note models.Note
+	if err := h.db.Where("user_id = ? AND id = ?", c.GetString("user_id"), c.Param("id")).First(&note).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found", "code": "NOTE_NOT_FOUND"})
+		return note, false
+	}
+	return note, true
+}
+
+func (h *NotesHandler) findRevision(c *gin.Context, note models.Note, version string) (models.NoteRevision, bool) {
+	var rev models.NoteRevision
+	v, err := strconv.ParseInt(version, 10, 64)
+	if err == nil {
+		err = h.db.Where("note_id = ? AND version = ?", note.ID, v).First(&rev).Error
+	} else {
+		err = gorm.ErrRecordNotFound
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Revision not found", "code": "REVISION_NOT_FOUND"})
+		return rev, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch revision"})
+		return rev, false
+	}
+	return rev, true
+}
@@ -1,69 +1,1061 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/changelog"
 	"github.com/your-org/notes-api/internal/config"
 	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/realtime"
+)
+
+const (
+	syncDefaultLimit = 100
+	syncMaxLimit     = 500
 )
 
 type SyncHandler struct {
-	cfg config.Config
-	db  *gorm.DB
+	cfg         config.Config
+	db          *gorm.DB
+	hub         *realtime.Hub
+	revocations auth.RevocationStore
+	revisions   revisionLog
 }
 
-func NewSyncHandler(cfg config.Config, db *gorm.DB) *SyncHandler {
-	return &SyncHandler{cfg: cfg, db: db}
+func NewSyncHandler(cfg config.Config, db *gorm.DB, hub *realtime.Hub, revocations auth.RevocationStore) *SyncHandler {
+	return &SyncHandler{cfg: cfg, db: db, hub: hub, revocations: revocations, revisions: newRevisionLog(cfg)}
 }
 
+// Pull returns the changes after the given cursor, oldest first. A page holds
+// up to limit change log entries, collapsed to the latest state of each item.
+// While has_more is true the client keeps pulling with the returned cursor,
+// and it stores the final cursor for the next sync. An empty cursor is a full
+// sync from the start of the log.
 func (h *SyncHandler) Pull(c *gin.Context) {
-	// Simplified: return last 100 updated notes/categories
-	userID := c.GetString("user_id")
-	var notes []models.Note
-	var cats []models.Category
-	h.db.Where("user_id = ?", userID).Order("updated_at desc").Limit(100).Find(&notes)
-	h.db.Where("user_id = ?", userID).Order("updated_at desc").Limit(100).Find(&cats)
+	uid, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid user id", "code": "TOKEN_INVALID"})
+		return
+	}
+	cursor := c.Query("cursor")
+	after, err := changelog.DecodeCursor(cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid cursor", "code": "VALIDATION_ERROR", "details": gin.H{"cursor": "Must be a cursor returned by sync"}})
+		return
+	}
+	if after > 0 {
+		expired, err := changelog.CursorExpired(h.db, uid, after)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch changes"})
+			return
+		}
+		if expired {
+			c.JSON(http.StatusGone, gin.H{"success": false, "error": "Cursor has expired, start a full sync", "code": "SYNC_CURSOR_EXPIRED"})
+			return
+		}
+	}
+	h.acknowledge(c, uid, after)
+	// Tombstones only mean something to a client that already holds data, so
+	// they default to on for delta pulls and off for the initial one.
+	includeDeleted := after > 0
+	if v := c.Query("include_deleted"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid include_deleted", "code": "VALIDATION_ERROR", "details": gin.H{"include_deleted": "Must be true or false"}})
+			return
+		}
+		includeDeleted = b
+	}
+	limit := syncDefaultLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > syncMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid limit", "code": "VALIDATION_ERROR", "details": gin.H{"limit": "Must be between 1 and 500"}})
+			return
+		}
+		limit = n
+	}
+
+	// Fetch one extra entry to learn whether another page exists.
+	changes, err := changelog.Since(h.db, uid, after, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch changes"})
+		return
+	}
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+	next := after
+	if len(changes) > 0 {
+		next = changes[len(changes)-1].Seq
+	}
+
+	delta, err := h.loadDelta(uid, changes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch changes"})
+		return
+	}
+	if !includeDeleted {
+		delta.notes.Deleted = []uuid.UUID{}
+		delta.cats.Deleted = []uuid.UUID{}
+		delta.attachments.Deleted = []uuid.UUID{}
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
-		"notes":          gin.H{"created": notes, "updated": []models.Note{}, "deleted": []string{}},
-		"categories":     gin.H{"created": cats, "updated": []models.Category{}, "deleted": []string{}},
-		"sync_timestamp": time.Now().UTC(),
+		"notes":       delta.notes,
+		"categories":  delta.cats,
+		"attachments": delta.attachments,
+		"cursor":      changelog.EncodeCursor(next),
+		"has_more":    hasMore,
 	}})
 }
 
+// acknowledge records that the requesting device has applied everything up
+// to seq, which is implied by it pulling from there, and purges tombstones
+// that all of the user's devices have now seen. Failures only delay the
+// purge, so they do not fail the pull.
+func (h *SyncHandler) acknowledge(c *gin.Context, uid uuid.UUID, seq uint64) {
+	v, ok := c.Get("device")
+	if !ok {
+		return
+	}
+	d := v.(models.Device)
+	if d.AckedSeq == seq {
+		return
+	}
+	if err := h.db.Model(&d).Update("acked_seq", seq).Error; err != nil {
+		return
+	}
+	_ = changelog.PurgeTombstones(h.db, uid, time.Now().Add(-h.cfg.DeviceStaleAfter))
+}
+
+type noteDelta struct {
+	Created []models.Note `json:"created"`
+	Updated []models.Note `json:"updated"`
+	Deleted []uuid.UUID   `json:"deleted"`
+}
+
+type categoryDelta struct {
+	Created []models.Category `json:"created"`
+	Updated []models.Category `json:"updated"`
+	Deleted []uuid.UUID       `json:"deleted"`
+}
+
+// attachmentDelta lists attachments that were bound to a note, with their
+// note_id, and those that were deleted. Attachments are immutable, so there
+// is no separate updated list.
+type attachmentDelta struct {
+	Created []gin.H     `json:"created"`
+	Deleted []uuid.UUID `json:"deleted"`
+}
+
+type syncDelta struct {
+	notes       noteDelta
+	cats        categoryDelta
+	attachments attachmentDelta
+}
+
+// loadDelta collapses a page of changes to one entry per item and loads the
+// current rows. An item created within the page is reported as created even
+// if it was also updated; one whose last change is a delete is a tombstone.
+func (h *SyncHandler) loadDelta(uid uuid.UUID, changes []models.Change) (syncDelta, error) {
+	type state struct {
+		created bool
+		op      string
+	}
+	states := map[string]map[uuid.UUID]*state{}
+	order := map[string][]uuid.UUID{}
+	for _, ch := range changes {
+		if states[ch.Entity] == nil {
+			states[ch.Entity] = map[uuid.UUID]*state{}
+		}
+		st, ok := states[ch.Entity][ch.EntityID]
+		if !ok {
+			st = &state{}
+			states[ch.Entity][ch.EntityID] = st
+			order[ch.Entity] = append(order[ch.Entity], ch.EntityID)
+		}
+		st.op = ch.Op
+		if ch.Op == changelog.OpCreate {
+			st.created = true
+		}
+	}
+
+	d := syncDelta{
+		notes:       noteDelta{Created: []models.Note{}, Updated: []models.Note{}, Deleted: []uuid.UUID{}},
+		cats:        categoryDelta{Created: []models.Category{}, Updated: []models.Category{}, Deleted: []uuid.UUID{}},
+		attachments: attachmentDelta{Created: []gin.H{}, Deleted: []uuid.UUID{}},
+	}
+
+	var noteIDs []uuid.UUID
+	for _, id := range order[changelog.EntityNote] {
+		if states[changelog.EntityNote][id].op == changelog.OpDelete {
+			d.notes.Deleted = append(d.notes.Deleted, id)
+		} else {
+			noteIDs = append(noteIDs, id)
+		}
+	}
+	if len(noteIDs) > 0 {
+		var notes []models.Note
+		if err := h.db.Where("user_id = ? AND id IN ?", uid, noteIDs).Find(&notes).Error; err != nil {
+			return d, err
+		}
+		byID := map[uuid.UUID]models.Note{}
+		for _, n := range notes {
+			byID[n.ID] = n
+		}
+		// Rows missing here were deleted after this page; a later page
+		// carries their tombstones.
+		for _, id := range noteIDs {
+			n, ok := byID[id]
+			switch {
+			case !ok:
+			case states[changelog.EntityNote][id].created:
+				d.notes.Created = append(d.notes.Created, n)
+			default:
+				d.notes.Updated = append(d.notes.Updated, n)
+			}
+		}
+	}
+
+	var catIDs []uuid.UUID
+	for _, id := range order[changelog.EntityCategory] {
+		if states[changelog.EntityCategory][id].op == changelog.OpDelete {
+			d.cats.Deleted = append(d.cats.Deleted, id)
+		} else {
+			catIDs = append(catIDs, id)
+		}
+	}
+	if len(catIDs) > 0 {
+		var cats []models.Category
+		if err := h.db.Where("user_id = ? AND id IN ?", uid, catIDs).Find(&cats).Error; err != nil {
+			return d, err
+		}
+		byID := map[uuid.UUID]models.Category{}
+		for _, cat := range cats {
+			byID[cat.ID] = cat
+		}
+		for _, id := range catIDs {
+			cat, ok := byID[id]
+			switch {
+			case !ok:
+			case states[changelog.EntityCategory][id].created:
+				d.cats.Created = append(d.cats.Created, cat)
+			default:
+				d.cats.Updated = append(d.cats.Updated, cat)
+			}
+		}
+	}
+
+	var attIDs []uuid.UUID
+	for _, id := range order[changelog.EntityAttachment] {
+		if states[changelog.EntityAttachment][id].op == changelog.OpDelete {
+			d.attachments.Deleted = append(d.attachments.Deleted, id)
+		} else {
+			attIDs = append(attIDs, id)
+		}
+	}
+	if len(attIDs) > 0 {
+		var atts []models.Attachment
+		if err := h.db.Where("user_id = ? AND id IN ? AND note_id IS NOT NULL", uid, attIDs).Find(&atts).Error; err != nil {
+			return d, err
+		}
+		byID := map[uuid.UUID]models.Attachment{}
+		for _, a := range atts {
+			byID[a.ID] = a
+		}
+		for _, id := range attIDs {
+			if a, ok := byID[id]; ok {
+				d.attachments.Created = append(d.attachments.Created, attachmentJSON(a))
+			}
+		}
+	}
+	return d, nil
+}
+
+// BaseVersion on updates is the server version the client last saw. When it
+// no longer matches, the update is a conflict and is resolved according to
+// the request's conflict_policy.
+type syncNote struct {
+	ID          string   `json:"id"`
+	MutationID  string   `json:"mutation_id"`
+	BaseVersion *int64   `json:"base_version"`
+	Title       string   `json:"title"`
+	Content     string   `json:"content"`
+	Category    *string  `json:"category"`
+	Tags        []string `json:"tags"`
+	Archived    bool     `json:"archived"`
+	// Pinned and Position are left as they are when omitted.
+	Pinned   *bool `json:"pinned"`
+	Position *int  `json:"position"`
+}
+
+// applyPlacement copies the client's pin and position, where given, onto
+// note.
+func (n syncNote) applyPlacement(note *models.Note) {
+	if n.Pinned != nil {
+		note.Pinned = *n.Pinned
+	}
+	if n.Position != nil {
+		note.Position = *n.Position
+	}
+}
+
+type syncCategory struct {
+	ID          string  `json:"id"`
+	MutationID  string  `json:"mutation_id"`
+	BaseVersion *int64  `json:"base_version"`
+	Name        string  `json:"name"`
+	Color       *string `json:"color"`
+}
+
+// syncAttachmentBind attaches a staged upload to a note. NoteID may be the
+// temp ID of a note created earlier in the same push.
+type syncAttachmentBind struct {
+	ID         string `json:"id"`
+	NoteID     string `json:"note_id"`
+	MutationID string `json:"mutation_id"`
+}
+
+// syncDelete names an item to delete. It is sent either as a bare ID or, to
+// make the delete idempotent, as {"id": ..., "mutation_id": ...}.
+type syncDelete struct {
+	ID         string `json:"id"`
+	MutationID string `json:"mutation_id"`
+}
+
+func (d *syncDelete) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &d.ID); err == nil {
+		return nil
+	}
+	type plain syncDelete
+	return json.Unmarshal(b, (*plain)(d))
+}
+
+type syncPushReq struct {
+	Notes struct {
+		Create []syncNote   `json:"create"`
+		Update []syncNote   `json:"update"`
+		Delete []syncDelete `json:"delete"`
+	} `json:"notes"`
+	Categories struct {
+		Create []syncCategory `json:"create"`
+		Update []syncCategory `json:"update"`
+		Delete []syncDelete   `json:"delete"`
+	} `json:"categories"`
+	Attachments struct {
+		Bind   []syncAttachmentBind `json:"bind"`
+		Delete []syncDelete         `json:"delete"`
+	} `json:"attachments"`
+	Cursor         string `json:"cursor"`
+	ConflictPolicy string `json:"conflict_policy"`
+}
+
+// Conflict policies a client can choose per push. server_wins drops the
+// client's change, client_wins applies it anyway and keep_both stores it as a
+// new copy next to the server's version.
+const (
+	policyServerWins = "server_wins"
+	policyClientWins = "client_wins"
+	policyKeepBoth   = "keep_both"
+)
+
+// syncConflict carries both sides of a stale update. Server is nil when the
+// item was deleted on the server.
+type syncConflict struct {
+	Entity     string      `json:"entity"`
+	ID         string      `json:"id"`
+	ServerID   string      `json:"server_id"`
+	Resolution string      `json:"resolution"`
+	CopyID     string      `json:"copy_id,omitempty"`
+	Server     interface{} `json:"server"`
+	Client     interface{} `json:"client"`
+	Merge      *noteMerge  `json:"merge,omitempty"`
+}
+
+// syncResult reports the outcome of a single pushed item. ID echoes the ID the
+// client sent, ServerID is the ID the row has on the server. Replayed is set
+// when the mutation had already been applied by an earlier push.
+type syncResult struct {
+	Entity     string `json:"entity"`
+	Op         string `json:"op"`
+	ID         string `json:"id"`
+	MutationID string `json:"mutation_id,omitempty"`
+	ServerID   string `json:"server_id,omitempty"`
+	Status     string `json:"status"`
+	Code       string `json:"code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Replayed   bool   `json:"replayed,omitempty"`
+
+	conflict *syncConflict
+}
+
+// syncOutcome is what gets stored for an applied mutation so that a replay
+// can return exactly what the first push did.
+type syncOutcome struct {
+	Result   syncResult    `json:"result"`
+	Conflict *syncConflict `json:"conflict,omitempty"`
+}
+
+// syncMutationTTL bounds how long applied mutation IDs are remembered. A
+// client retrying after that long has to resolve duplicates itself.
+const syncMutationTTL = 30 * 24 * time.Hour
+
+const (
+	syncApplied    = "applied"
+	syncConflicted = "conflict"
+	syncMerged     = "merged"
+	syncNotFound   = "not_found"
+	syncFailed     = "failed"
+	syncRolledBack = "rolled_back"
+)
+
+// errSyncRejected aborts the push transaction after an item failed.
+var errSyncRejected = errors.New("sync rejected")
+
+// syncPush holds the state of one push while it is applied inside a
+// transaction.
+type syncPush struct {
+	tx          *gorm.DB
+	userID      uuid.UUID
+	author      revisionAuthor
+	revisions   revisionLog
+	policy      string
+	results     []syncResult
+	conflicts   []syncConflict
+	createdNote map[string]string
+	createdCat  map[string]string
+	changes     []models.Change
+	// removedFiles are attachment files to delete once the push commits.
+	removedFiles []string
+	failed       bool
+}
+
+func (p *syncPush) record(r syncResult) {
+	if r.MutationID != "" && r.Status != syncFailed {
+		b, _ := json.Marshal(syncOutcome{Result: r, Conflict: r.conflict})
+		m := models.SyncMutation{UserID: p.userID, MutationID: r.MutationID, Outcome: string(b)}
+		if err := p.tx.Create(&m).Error; err != nil {
+			r.Status, r.Code, r.Error, r.conflict = syncFailed, "", "Failed to record mutation", nil
+		}
+	}
+	if r.Status == syncFailed {
+		p.failed = true
+	}
+	if r.conflict != nil {
+		p.conflicts = append(p.conflicts, *r.conflict)
+	}
+	p.results = append(p.results, r)
+}
+
+// replay reports a mutation that an earlier push already applied, returning
+// its original result instead of applying it again. It returns false when
+// mutationID is new.
+func (p *syncPush) replay(r syncResult) bool {
+	if r.MutationID == "" {
+		return false
+	}
+	if len(r.MutationID) > 64 {
+		r.Status, r.Code, r.Error = syncFailed, "VALIDATION_ERROR", "mutation_id must be at most 64 characters"
+		p.record(r)
+		return true
+	}
+	var m models.SyncMutation
+	if err := p.tx.Where("user_id = ? AND mutation_id = ?", p.userID, r.MutationID).First(&m).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			r.Status, r.Error = syncFailed, "Failed to look up mutation"
+			p.record(r)
+			return true
+		}
+		return false
+	}
+	var out syncOutcome
+	if err := json.Unmarshal([]byte(m.Outcome), &out); err != nil {
+		r.Status, r.Error = syncFailed, "Failed to read recorded mutation"
+		p.record(r)
+		return true
+	}
+	prev := out.Result
+	prev.Replayed = true
+	if prev.Op == "create" && prev.ID != "" && prev.ServerID != "" {
+		switch prev.Entity {
+		case "note":
+			p.createdNote[prev.ID] = prev.ServerID
+		case "category":
+			p.createdCat[prev.ID] = prev.ServerID
+		}
+	}
+	if out.Conflict != nil {
+		p.conflicts = append(p.conflicts, *out.Conflict)
+	}
+	p.results = append(p.results, prev)
+	return true
+}
+
+// resolveID maps a client ID to a server ID, following temp IDs that were
+// created earlier in the same push.
+func resolveID(created map[string]string, id string) (uuid.UUID, error) {
+	if sid, ok := created[id]; ok {
+		id = sid
+	}
+	return uuid.Parse(id)
+}
+
+// Push applies every section of the request in one transaction. If any item
+// fails nothing is committed and the response lists which item failed, so the
+// client can fix or drop it and retry the whole batch.
 func (h *SyncHandler) Push(c *gin.Context) {
-	userID := c.GetString("user_id")
-	var body map[string]map[string][]map[string]interface{}
-	if err := c.ShouldBindJSON(&body); err != nil {
+	uid, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid user id", "code": "TOKEN_INVALID"})
+		return
+	}
+	var req syncPushReq
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request", "code": "VALIDATION_ERROR"})
 		return
 	}
-	createdNotes := map[string]string{}
-	createdCats := map[string]string{}
-	// Only handle notes.create minimal
-	if body != nil {
-		if section, ok := body["notes"]; ok {
-			if notesCreate, ok := section["create"]; ok {
-				for _, n := range notesCreate {
-					id := uuid.New()
-					title, _ := n["title"].(string)
-					content, _ := n["content"].(string)
-					m := models.Note{ID: id, UserID: uuid.MustParse(userID), Title: title, Content: content}
-					h.db.Create(&m)
-					if localID, ok := n["id"].(string); ok && localID != "" {
-						createdNotes[localID] = id.String()
-					}
-				}
+	switch req.ConflictPolicy {
+	case "":
+		req.ConflictPolicy = policyServerWins
+	case policyServerWins, policyClientWins, policyKeepBoth:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid conflict_policy", "code": "VALIDATION_ERROR", "details": gin.H{"conflict_policy": "Must be server_wins, client_wins or keep_both"}})
+		return
+	}
+	after, err := changelog.DecodeCursor(req.Cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid cursor", "code": "VALIDATION_ERROR", "details": gin.H{"cursor": "Must be a cursor returned by sync"}})
+		return
+	}
+	p := &syncPush{
+		userID:      uid,
+		author:      authorOf(c),
+		revisions:   h.revisions,
+		policy:      req.ConflictPolicy,
+		conflicts:   []syncConflict{},
+		createdNote: map[string]string{},
+		createdCat:  map[string]string{},
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		p.tx = tx
+		for _, cat := range req.Categories.Create {
+			p.createCategory(cat)
+		}
+		for _, cat := range req.Categories.Update {
+			p.updateCategory(cat)
+		}
+		for _, n := range req.Notes.Create {
+			p.createNote(n)
+		}
+		for _, n := range req.Notes.Update {
+			p.updateNote(n)
+		}
+		for _, b := range req.Attachments.Bind {
+			p.bindAttachment(b)
+		}
+		for _, d := range req.Attachments.Delete {
+			p.deleteAttachment(d)
+		}
+		for _, d := range req.Notes.Delete {
+			p.deleteNote(d)
+		}
+		for _, d := range req.Categories.Delete {
+			p.deleteCategory(d)
+		}
+		if p.failed {
+			return errSyncRejected
+		}
+		return tx.Where("user_id = ? AND created_at < ?", uid, time.Now().Add(-syncMutationTTL)).Delete(&models.SyncMutation{}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, errSyncRejected) {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Sync failed"})
+			return
+		}
+		for i := range p.results {
+			if p.results[i].Status != syncFailed {
+				p.results[i].Status = syncRolledBack
 			}
 		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "error": "Sync rejected, no changes were applied", "code": "SYNC_REJECTED", "data": gin.H{
+			"results": p.results,
+		}})
+		return
+	}
+	for _, path := range p.removedFiles {
+		_ = os.Remove(path)
 	}
+	h.hub.Publish(p.changes...)
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Sync completed successfully", "data": gin.H{
-		"conflicts":      []string{},
-		"created_ids":    gin.H{"notes": createdNotes, "categories": createdCats},
-		"sync_timestamp": time.Now().UTC(),
+		"conflicts":   p.conflicts,
+		"created_ids": gin.H{"notes": p.createdNote, "categories": p.createdCat},
+		"results":     p.results,
+		"cursor":      changelog.EncodeCursor(h.advanceCursor(uid, after, p.changes)),
 	}})
 }
+
+// advanceCursor moves the client's cursor past the changes its own push just
+// made, so it does not pull them back. That is only safe when no other change
+// landed after the cursor in the meantime; otherwise the cursor is returned
+// unchanged and the next pull will include the push's changes as well.
+func (h *SyncHandler) advanceCursor(uid uuid.UUID, after uint64, changes []models.Change) uint64 {
+	if len(changes) == 0 {
+		return after
+	}
+	seqs := make([]uint64, len(changes))
+	for i, ch := range changes {
+		seqs[i] = ch.Seq
+	}
+	var others int64
+	err := h.db.Model(&models.Change{}).
+		Where("user_id = ? AND seq > ? AND seq NOT IN ?", uid, after, seqs).
+		Count(&others).Error
+	if err != nil || others > 0 {
+		return after
+	}
+	return seqs[len(seqs)-1]
+}
+
+func validateSyncNote(n syncNote) (string, bool) {
+	if strings.TrimSpace(n.Title) == "" {
+		return "Title cannot be empty", false
+	}
+	if len(n.Title) > 200 {
+		return "Title must be at most 200 characters", false
+	}
+	return "", true
+}
+
+func validateSyncCategory(cat syncCategory) (string, bool) {
+	if strings.TrimSpace(cat.Name) == "" {
+		return "Name cannot be empty", false
+	}
+	if len(cat.Name) > 50 {
+		return "Name must be at most 50 characters", false
+	}
+	return "", true
+}
+
+// conflictCopyName suffixes the name of a keep_both copy, trimming the
+// original so the result still fits in max bytes.
+func conflictCopyName(name string, max int) string {
+	const suffix = " (conflicted copy)"
+	name = strings.TrimSpace(name)
+	for len(name)+len(suffix) > max {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name + suffix
+}
+
+// logChange appends to the user's change log and remembers the change so it
+// can be published, and the response cursor advanced past the push's own
+// writes, once the transaction commits.
+func (p *syncPush) logChange(entity string, id uuid.UUID, op string) error {
+	change, err := changelog.Record(p.tx, p.userID, entity, id, op)
+	if err != nil {
+		return err
+	}
+	p.changes = append(p.changes, change)
+	return nil
+}
+
+func (p *syncPush) createNoteRow(note *models.Note) error {
+	if err := p.tx.Create(note).Error; err != nil {
+		return err
+	}
+	if err := p.revisions.save(p.tx, *note, p.author); err != nil {
+		return err
+	}
+	return p.logChange(changelog.EntityNote, note.ID, changelog.OpCreate)
+}
+
+// saveNote writes an updated note that was read at version prev, including
+// one that is being restored from a soft delete, and records its new
+// revision. Like every note write it fails with errNoteChanged if another
+// request changed the note since it was read.
+func (p *syncPush) saveNote(note *models.Note, prev int64) error {
+	if err := writeNote(p.tx.Unscoped(), note, prev); err != nil {
+		return err
+	}
+	if err := p.revisions.save(p.tx, *note, p.author); err != nil {
+		return err
+	}
+	return p.logChange(changelog.EntityNote, note.ID, changelog.OpUpdate)
+}
+
+// lostRace reports an update whose write lost to a request that changed the
+// item after the push read it. The client's change is not applied, whatever
+// the conflict policy, and the conflict carries the item as it is now so the
+// client can redo the change from there. current is a locking read because a
+// plain one would return the transaction's stale snapshot.
+func (p *syncPush) lostRace(r syncResult, entity string, client interface{}, current interface{}) {
+	conflict := syncConflict{Entity: entity, ID: r.ID, ServerID: r.ServerID, Resolution: policyServerWins, Client: client}
+	err := p.tx.Unscoped().Clauses(clause.Locking{Strength: "SHARE"}).Where("user_id = ? AND id = ?", p.userID, r.ServerID).First(current).Error
+	if err == nil {
+		conflict.Server = current
+	}
+	r.conflict = &conflict
+	r.Status = syncConflicted
+	p.record(r)
+}
+
+func (p *syncPush) createCategoryRow(cat *models.Category) error {
+	if err := p.tx.Create(cat).Error; err != nil {
+		return err
+	}
+	return p.logChange(changelog.EntityCategory, cat.ID, changelog.OpCreate)
+}
+
+func (p *syncPush) createNote(n syncNote) {
+	r := syncResult{Entity: "note", Op: "create", ID: n.ID, MutationID: n.MutationID}
+	if p.replay(r) {
+		return
+	}
+	if msg, ok := validateSyncNote(n); !ok {
+		r.Status, r.Code, r.Error = syncFailed, "VALIDATION_ERROR", msg
+		p.record(r)
+		return
+	}
+	note := models.Note{
+		ID:       uuid.New(),
+		UserID:   p.userID,
+		Title:    n.Title,
+		Content:  n.Content,
+		Category: n.Category,
+		Tags:     append([]string{}, n.Tags...),
+		Archived: n.Archived,
+		Version:  1,
+	}
+	n.applyPlacement(&note)
+	if err := p.createNoteRow(&note); err != nil {
+		r.Status, r.Error = syncFailed, "Failed to create note"
+		p.record(r)
+		return
+	}
+	if n.ID != "" {
+		p.createdNote[n.ID] = note.ID.String()
+	}
+	r.ServerID, r.Status = note.ID.String(), syncApplied
+	p.record(r)
+}
+
+func (p *syncPush) updateNote(n syncNote) {
+	r := syncResult{Entity: "note", Op: "update", ID: n.ID, MutationID: n.MutationID}
+	if p.replay(r) {
+		return
+	}
+	if msg, ok := validateSyncNote(n); !ok {
+		r.Status, r.Code, r.Error = syncFailed, "VALIDATION_ERROR", msg
+		p.record(r)
+		return
+	}
+	id, err := resolveID(p.createdNote, n.ID)
+	var note models.Note
+	if err != nil || p.tx.Unscoped().Where("user_id = ? AND id = ?", p.userID, id).First(&note).Error != nil {
+		r.Status, r.Code, r.Error = syncFailed, "NOTE_NOT_FOUND", "Note not found"
+		p.record(r)
+		return
+	}
+	r.ServerID = note.ID.String()
+	if note.DeletedAt.Valid || (n.BaseVersion != nil && *n.BaseVersion != note.Version) {
+		conflict := syncConflict{Entity: "note", ID: n.ID, ServerID: note.ID.String(), Resolution: p.policy, Client: n}
+		if !note.DeletedAt.Valid {
+			conflict.Server = note
+			// Concurrent edits from a known base are merged; only edits that
+			// overlap fall through to the conflict policy.
+			merged, report, err := p.mergeNote(note, n)
+			if err != nil {
+				r.Status, r.Error = syncFailed, "Failed to merge note"
+				p.record(r)
+				return
+			}
+			if merged != nil && report == nil {
+				merged.Version++
+				if err := p.saveNote(merged, note.Version); err != nil {
+					if errors.Is(err, errNoteChanged) {
+						p.lostRace(r, "note", n, &models.Note{})
+						return
+					}
+					r.Status, r.Error = syncFailed, "Failed to update note"
+					p.record(r)
+					return
+				}
+				r.Status = syncMerged
+				p.record(r)
+				return
+			}
+			conflict.Merge = report
+		}
+		switch p.policy {
+		case policyServerWins:
+			r.conflict = &conflict
+			r.Status = syncConflicted
+			p.record(r)
+			return
+		case policyKeepBoth:
+			copyNote := models.Note{
+				ID:       uuid.New(),
+				UserID:   p.userID,
+				Title:    conflictCopyName(n.Title, 200),
+				Content:  n.Content,
+				Category: n.Category,
+				Tags:     append([]string{}, n.Tags...),
+				Archived: n.Archived,
+				Version:  1,
+			}
+			n.applyPlacement(&copyNote)
+			if err := p.createNoteRow(&copyNote); err != nil {
+				r.Status, r.Error = syncFailed, "Failed to create conflict copy"
+				p.record(r)
+				return
+			}
+			conflict.CopyID = copyNote.ID.String()
+			r.conflict = &conflict
+			r.ServerID, r.Status = copyNote.ID.String(), syncConflicted
+			p.record(r)
+			return
+		}
+		// client_wins: overwrite, bringing the note back if it was deleted.
+		r.conflict = &conflict
+		note.DeletedAt = gorm.DeletedAt{}
+	}
+	note.Title = n.Title
+	note.Content = n.Content
+	note.Category = n.Category
+	note.Tags = append([]string{}, n.Tags...)
+	note.Archived = n.Archived
+	n.applyPlacement(&note)
+	note.Version++
+	if err := p.saveNote(&note, note.Version-1); err != nil {
+		if errors.Is(err, errNoteChanged) {
+			p.lostRace(r, "note", n, &models.Note{})
+			return
+		}
+		r.Status, r.Error = syncFailed, "Failed to update note"
+		p.record(r)
+		return
+	}
+	r.Status = syncApplied
+	p.record(r)
+}
+
+// deleteNote is idempotent: deleting a note that is already gone is reported
+// as not_found but does not fail the push.
+func (p *syncPush) deleteNote(d syncDelete) {
+	r := syncResult{Entity: "note", Op: "delete", ID: d.ID, MutationID: d.MutationID}
+	if p.replay(r) {
+		return
+	}
+	id, err := resolveID(p.createdNote, d.ID)
+	if err != nil {
+		r.Status = syncNotFound
+		p.record(r)
+		return
+	}
+	res := p.tx.Where("user_id = ? AND id = ?", p.userID, id).Delete(&models.Note{})
+	switch {
+	case res.Error != nil:
+		r.Status, r.Error = syncFailed, "Failed to delete note"
+	case res.RowsAffected == 0:
+		r.Status = syncNotFound
+	case p.logChange(changelog.EntityNote, id, changelog.OpDelete) != nil:
+		r.Status, r.Error = syncFailed, "Failed to delete note"
+	default:
+		r.ServerID, r.Status = id.String(), syncApplied
+	}
+	p.record(r)
+}
+
+func (p *syncPush) createCategory(cat syncCategory) {
+	r := syncResult{Entity: "category", Op: "create", ID: cat.ID, MutationID: cat.MutationID}
+	if p.replay(r) {
+		return
+	}
+	if msg, ok := validateSyncCategory(cat); !ok {
+		r.Status, r.Code, r.Error = syncFailed, "VALIDATION_ERROR", msg
+		p.record(r)
+		return
+	}
+	m := models.Category{ID: uuid.New(), UserID: p.userID, Name: cat.Name, Color: cat.Color, Version: 1}
+	if err := p.createCategoryRow(&m); err != nil {
+		r.Status, r.Error = syncFailed, "Failed to create category"
+		p.record(r)
+		return
+	}
+	if cat.ID != "" {
+		p.createdCat[cat.ID] = m.ID.String()
+	}
+	r.ServerID, r.Status = m.ID.String(), syncApplied
+	p.record(r)
+}
+
+func (p *syncPush) updateCategory(cat syncCategory) {
+	r := syncResult{Entity: "category", Op: "update", ID: cat.ID, MutationID: cat.MutationID}
+	if p.replay(r) {
+		return
+	}
+	if msg, ok := validateSyncCategory(cat); !ok {
+		r.Status, r.Code, r.Error = syncFailed, "VALIDATION_ERROR", msg
+		p.record(r)
+		return
+	}
+	id, err := resolveID(p.createdCat, cat.ID)
+	var m models.Category
+	if err != nil || p.tx.Where("user_id = ? AND id = ?", p.userID, id).First(&m).Error != nil {
+		r.Status, r.Code, r.Error = syncFailed, "CATEGORY_NOT_FOUND", "Category not found"
+		p.record(r)
+		return
+	}
+	r.ServerID = m.ID.String()
+	if cat.BaseVersion != nil && *cat.BaseVersion != m.Version {
+		conflict := syncConflict{Entity: "category", ID: cat.ID, ServerID: m.ID.String(), Resolution: p.policy, Server: m, Client: cat}
+		switch p.policy {
+		case policyServerWins:
+			r.conflict = &conflict
+			r.Status = syncConflicted
+			p.record(r)
+			return
+		case policyKeepBoth:
+			copyCat := models.Category{ID: uuid.New(), UserID: p.userID, Name: conflictCopyName(cat.Name, 50), Color: cat.Color, Version: 1}
+			if err := p.createCategoryRow(&copyCat); err != nil {
+				r.Status, r.Error = syncFailed, "Failed to create conflict copy"
+				p.record(r)
+				return
+			}
+			conflict.CopyID = copyCat.ID.String()
+			r.conflict = &conflict
+			r.ServerID, r.Status = copyCat.ID.String(), syncConflicted
+			p.record(r)
+			return
+		}
+		r.conflict = &conflict
+	}
+	m.Name = cat.Name
+	m.Color = cat.Color
+	m.Version++
+	// Only write over the version that was read, as writeNote does for notes.
+	res := p.tx.Model(&m).Where("version = ?", m.Version-1).Select("*").Updates(&m)
+	err = res.Error
+	if err == nil && res.RowsAffected == 0 {
+		p.lostRace(r, "category", cat, &models.Category{})
+		return
+	}
+	if err == nil {
+		err = p.logChange(changelog.EntityCategory, m.ID, changelog.OpUpdate)
+	}
+	if err != nil {
+		r.Status, r.Error = syncFailed, "Failed to update category"
+		p.record(r)
+		return
+	}
+	r.Status = syncApplied
+	p.record(r)
+}
+
+func (p *syncPush) deleteCategory(d syncDelete) {
+	r := syncResult{Entity: "category", Op: "delete", ID: d.ID, MutationID: d.MutationID}
+	if p.replay(r) {
+		return
+	}
+	id, err := resolveID(p.createdCat, d.ID)
+	if err != nil {
+		r.Status = syncNotFound
+		p.record(r)
+		return
+	}
+	res := p.tx.Where("user_id = ? AND id = ?", p.userID, id).Delete(&models.Category{})
+	switch {
+	case res.Error != nil:
+		r.Status, r.Error = syncFailed, "Failed to delete category"
+	case res.RowsAffected == 0:
+		r.Status = syncNotFound
+	case p.logChange(changelog.EntityCategory, id, changelog.OpDelete) != nil:
+		r.Status, r.Error = syncFailed, "Failed to delete category"
+	default:
+		r.ServerID, r.Status = id.String(), syncApplied
+	}
+	p.record(r)
+}
+
+func (p *syncPush) bindAttachment(b syncAttachmentBind) {
+	r := syncResult{Entity: "attachment", Op: "bind", ID: b.ID, MutationID: b.MutationID}
+	if p.replay(r) {
+		return
+	}
+	noteID, err := resolveID(p.createdNote, b.NoteID)
+	var note models.Note
+	if err != nil || p.tx.Where("user_id = ? AND id = ?", p.userID, noteID).First(&note).Error != nil {
+		r.Status, r.Code, r.Error = syncFailed, "NOTE_NOT_FOUND", "Note not found"
+		p.record(r)
+		return
+	}
+	id, err := uuid.Parse(b.ID)
+	var a models.Attachment
+	if err != nil || p.tx.Where("user_id = ? AND id = ?", p.userID, id).First(&a).Error != nil {
+		r.Status, r.Code, r.Error = syncFailed, "ATTACHMENT_NOT_FOUND", "Attachment not found"
+		p.record(r)
+		return
+	}
+	r.ServerID = a.ID.String()
+	if a.NoteID != nil {
+		if *a.NoteID != note.ID {
+			r.Status, r.Code, r.Error = syncFailed, "ATTACHMENT_ALREADY_BOUND", "Attachment belongs to another note"
+		} else {
+			r.Status = syncApplied
+		}
+		p.record(r)
+		return
+	}
+	err = p.tx.Model(&a).Update("note_id", note.ID).Error
+	if err == nil {
+		err = p.logChange(changelog.EntityAttachment, a.ID, changelog.OpCreate)
+	}
+	if err != nil {
+		r.Status, r.Error = syncFailed, "Failed to bind attachment"
+		p.record(r)
+		return
+	}
+	r.Status = syncApplied
+	p.record(r)
+}
+
+func (p *syncPush) deleteAttachment(d syncDelete) {
+	r := syncResult{Entity: "attachment", Op: "delete", ID: d.ID, MutationID: d.MutationID}
+	if p.replay(r) {
+		return
+	}
+	id, err := uuid.Parse(d.ID)
+	var a models.Attachment
+	if err != nil || p.tx.Where("user_id = ? AND id = ?", p.userID, id).First(&a).Error != nil {
+		r.Status = syncNotFound
+		p.record(r)
+		return
+	}
+	err = p.tx.Delete(&a).Error
+	if err == nil && a.NoteID != nil {
+		err = p.logChange(changelog.EntityAttachment, a.ID, changelog.OpDelete)
+	}
+	if err != nil {
+		r.Status, r.Error = syncFailed, "Failed to delete attachment"
+		p.record(r)
+		return
+	}
+	p.removedFiles = append(p.removedFiles, a.StoragePath)
+	r.ServerID, r.Status = a.ID.String(), syncApplied
+	p.record(r)
+}
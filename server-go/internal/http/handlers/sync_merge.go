@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/merge"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// mergeHunk is one overlapping region of a failed merge, with the lines each
+// side put in place of the base lines.
+type mergeHunk struct {
+	BaseStart int      `json:"base_start"`
+	Base      []string `json:"base"`
+	Server    []string `json:"server"`
+	Client    []string `json:"client"`
+}
+
+// mergeText describes a field whose merge had overlaps. Text is the merged
+// value with diff3-style conflict markers around each hunk.
+type mergeText struct {
+	Text  string      `json:"text"`
+	Hunks []mergeHunk `json:"hunks"`
+}
+
+// noteMerge is reported with a note conflict when a three-way merge was
+// attempted but could not be completed automatically.
+type noteMerge struct {
+	Title   *mergeText `json:"title,omitempty"`
+	Content *mergeText `json:"content,omitempty"`
+	Fields  []string   `json:"fields,omitempty"`
+}
+
+// mergeNote three-way merges the client's edit into the server's note using
+// the revision the client based it on. It returns a nil note when that base
+// revision is unknown, and a non-nil report when the edits overlap.
+func (p *syncPush) mergeNote(server models.Note, client syncNote) (*models.Note, *noteMerge, error) {
+	var base models.NoteRevision
+	err := p.tx.Where("note_id = ? AND version = ?", server.ID, *client.BaseVersion).First(&base).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := server
+	report := &noteMerge{}
+	conflicted := false
+
+	title := merge.Merge(base.Title, server.Title, client.Title)
+	if !title.Clean() {
+		report.Title = reportMerge(title)
+		conflicted = true
+	} else if t := title.Text("server", "client"); strings.TrimSpace(t) == "" || len(t) > 200 {
+		// Both sides' titles were valid, but combining their lines may not
+		// be, so the title as a whole is left to the client.
+		report.Title = &mergeText{Text: t, Hunks: []mergeHunk{{
+			Base:   strings.Split(base.Title, "\n"),
+			Server: strings.Split(server.Title, "\n"),
+			Client: strings.Split(client.Title, "\n"),
+		}}}
+		conflicted = true
+	} else {
+		merged.Title = t
+	}
+	content := merge.Merge(base.Content, server.Content, client.Content)
+	if content.Clean() {
+		merged.Content = content.Text("server", "client")
+	} else {
+		report.Content = reportMerge(content)
+		conflicted = true
+	}
+
+	switch {
+	case equalStringPtr(client.Category, base.Category), equalStringPtr(client.Category, server.Category):
+	case equalStringPtr(server.Category, base.Category):
+		merged.Category = client.Category
+	default:
+		report.Fields = append(report.Fields, "category")
+		conflicted = true
+	}
+	switch {
+	case client.Archived == base.Archived, client.Archived == server.Archived:
+	case server.Archived == base.Archived:
+		merged.Archived = client.Archived
+	}
+	if client.Pinned != nil {
+		switch {
+		case *client.Pinned == base.Pinned, *client.Pinned == server.Pinned:
+		case server.Pinned == base.Pinned:
+			merged.Pinned = *client.Pinned
+		}
+	}
+	if client.Position != nil {
+		switch {
+		case *client.Position == base.Position, *client.Position == server.Position:
+		case server.Position == base.Position:
+			merged.Position = *client.Position
+		}
+	}
+	merged.Tags = mergeTags(base.Tags, server.Tags, client.Tags)
+
+	if conflicted {
+		return &merged, report, nil
+	}
+	return &merged, nil, nil
+}
+
+func reportMerge(r merge.Result) *mergeText {
+	out := &mergeText{Text: r.Text("server", "client"), Hunks: []mergeHunk{}}
+	for _, c := range r.Conflicts {
+		out.Hunks = append(out.Hunks, mergeHunk{BaseStart: c.BaseStart, Base: c.Base, Server: c.Ours, Client: c.Theirs})
+	}
+	return out
+}
+
+// mergeTags applies the tags the client added and removed relative to base
+// on top of the server's tags. Tag edits never conflict.
+func mergeTags(base, server, client []string) []string {
+	inBase := map[string]bool{}
+	for _, t := range base {
+		inBase[t] = true
+	}
+	inClient := map[string]bool{}
+	for _, t := range client {
+		inClient[t] = true
+	}
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range server {
+		if inBase[t] && !inClient[t] {
+			continue
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	for _, t := range client {
+		if !inBase[t] && !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
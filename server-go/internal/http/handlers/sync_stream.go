@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/changelog"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// streamPollInterval is how often an idle stream sends a heartbeat and
+// re-reads the change log, which picks up changes dropped for a slow stream
+// or committed by another API instance.
+const streamPollInterval = 25 * time.Second
+
+// Stream sends the user's changes as Server-Sent Events. Every event's id is
+// the cursor after that change, so a client that reconnects with
+// Last-Event-ID (or ?cursor=) resumes exactly where it left off. Events only
+// name what changed; clients fetch the data with GET /sync.
+func (h *SyncHandler) Stream(c *gin.Context) {
+	uid, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid user id", "code": "TOKEN_INVALID"})
+		return
+	}
+	cursor := c.GetHeader("Last-Event-ID")
+	given := cursor != ""
+	if !given {
+		cursor, given = c.GetQuery("cursor")
+	}
+	after, err := changelog.DecodeCursor(cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid cursor", "code": "VALIDATION_ERROR", "details": gin.H{"cursor": "Must be a cursor returned by sync"}})
+		return
+	}
+	if !given {
+		// Without a cursor the stream starts at the present; history comes
+		// from a full pull. A cursor at the start of the log, as a pull of
+		// an empty account returns, is replayed from there like any other,
+		// so changes made since that pull are not skipped.
+		var counter models.SyncCounter
+		if err := h.db.Where("user_id = ?", uid).Limit(1).Find(&counter).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to open stream"})
+			return
+		}
+		after = counter.Seq
+	} else if expired, err := changelog.CursorExpired(h.db, uid, after); err != nil || expired {
+		c.JSON(http.StatusGone, gin.H{"success": false, "error": "Cursor has expired, start a full sync", "code": "SYNC_CURSOR_EXPIRED"})
+		return
+	}
+
+	// Subscribe before catching up so nothing committed in between is missed.
+	sub := h.hub.Subscribe(uid)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	send := func(ch models.Change) error {
+		data, _ := json.Marshal(gin.H{"seq": ch.Seq, "entity": ch.Entity, "id": ch.EntityID, "op": ch.Op})
+		_, err := fmt.Fprintf(w, "id: %s\nevent: change\ndata: %s\n\n", changelog.EncodeCursor(ch.Seq), data)
+		return err
+	}
+	// catchUp replays everything after the cursor from the change log.
+	catchUp := func() error {
+		for {
+			changes, err := changelog.Since(h.db, uid, after, syncMaxLimit)
+			if err != nil {
+				return err
+			}
+			for _, ch := range changes {
+				if err := send(ch); err != nil {
+					return err
+				}
+				after = ch.Seq
+			}
+			if len(changes) < syncMaxLimit {
+				return nil
+			}
+		}
+	}
+
+	if err := catchUp(); err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: ready\ndata: {\"cursor\":%q}\n\n", changelog.EncodeCursor(after))
+	w.Flush()
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case ch, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			switch {
+			case ch.Seq <= after:
+				continue
+			case ch.Seq == after+1:
+				if err := send(ch); err != nil {
+					return
+				}
+				after = ch.Seq
+			default:
+				// Publishes can arrive out of order or be dropped; the log
+				// is authoritative for everything up to this change.
+				if err := catchUp(); err != nil {
+					return
+				}
+			}
+		case <-ticker.C:
+			// The token and device were only checked when the stream
+			// opened, so a stream must not outlive either of them.
+			if code, err := h.streamRevoked(c, uid); err != nil || code != "" {
+				if code != "" {
+					fmt.Fprintf(w, "event: close\ndata: {\"code\":%q}\n\n", code)
+					w.Flush()
+				}
+				return
+			}
+			if err := catchUp(); err != nil {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		w.Flush()
+	}
+}
+
+// streamRevoked repeats the checks JWTAuth and Device made when the stream
+// opened. It returns the error code the request would get now, or "" if the
+// credential is still good.
+func (h *SyncHandler) streamRevoked(c *gin.Context, uid uuid.UUID) (string, error) {
+	now := time.Now().UTC()
+	tokenID := c.GetString("token_id")
+	if _, isPAT := c.Get("scopes"); isPAT {
+		var n int64
+		err := h.db.Model(&models.PersonalAccessToken{}).
+			Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", tokenID, now).
+			Count(&n).Error
+		if err != nil || n > 0 {
+			return "", err
+		}
+		return "TOKEN_INVALID", nil
+	}
+	if exp, ok := c.Get("token_expires_at"); ok && !now.Before(exp.(time.Time)) {
+		return "TOKEN_EXPIRED", nil
+	}
+	gen, err := h.revocations.Generation(uid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "TOKEN_INVALID", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	revoked := gen > c.GetInt64("token_generation")
+	if !revoked {
+		if revoked, err = h.revocations.IsRevoked(tokenID); err != nil {
+			return "", err
+		}
+	}
+	if revoked {
+		return "TOKEN_REVOKED", nil
+	}
+	if deviceID := c.GetString("device_id"); deviceID != "" {
+		var d models.Device
+		err := h.db.Select("revoked_at").Where("user_id = ? AND device_id = ?", uid, deviceID).First(&d).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && d.RevokedAt != nil) {
+			return "DEVICE_REVOKED", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
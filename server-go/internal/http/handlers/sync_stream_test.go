@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/your-org/notes-api/internal/changelog"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/dbtest"
+	"github.com/your-org/notes-api/internal/realtime"
+)
+
+// TestStreamZeroCursor checks that the starting cursor a pull of an empty
+// account returns is replayed from, while a stream opened without a cursor
+// starts at the present. One change was committed after the pull.
+func TestStreamZeroCursor(t *testing.T) {
+	userID, noteID := uuid.New(), uuid.New()
+	db := dbtest.Open(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case dbtest.Match(query, "SELECT * FROM sync_counters"):
+			return dbtest.Result{Columns: []string{"user_id", "seq", "purged_seq"}, Rows: [][]driver.Value{{userID.String(), int64(1), int64(0)}}}
+		case dbtest.Match(query, "SELECT * FROM changes"):
+			if args[1].(int64) >= 1 {
+				return dbtest.Result{}
+			}
+			return dbtest.Result{
+				Columns: []string{"user_id", "seq", "entity", "entity_id", "op"},
+				Rows:    [][]driver.Value{{userID.String(), int64(1), changelog.EntityNote, noteID.String(), changelog.OpCreate}},
+			}
+		}
+		return dbtest.Result{}
+	})
+	h := NewSyncHandler(config.Config{}, db, realtime.NewHub(), nil)
+
+	tests := []struct {
+		name   string
+		query  string
+		replay bool
+	}{
+		{name: "no cursor starts at the present", query: ""},
+		{name: "zero cursor replays", query: "?cursor=" + changelog.EncodeCursor(0), replay: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The request is already over, so the stream returns once it
+			// has caught up and sent ready.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/v1/sync/stream"+tt.query, nil).WithContext(ctx)
+			c.Set("user_id", userID.String())
+			h.Stream(c)
+
+			body := w.Body.String()
+			if !strings.Contains(body, "event: ready") {
+				t.Fatalf("stream did not get ready: %d %s", w.Code, body)
+			}
+			if got := strings.Contains(body, "event: change"); got != tt.replay {
+				t.Errorf("change replayed = %v, want %v; body %s", got, tt.replay, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/dbtest"
+	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/realtime"
+)
+
+// TestPushLosesRaceAsConflict checks that a pushed update whose write finds
+// the note changed since the push read it is reported as a conflict with the
+// current note, and that the rest of the push still commits.
+func TestPushLosesRaceAsConflict(t *testing.T) {
+	userID, noteID := uuid.New(), uuid.New()
+	var writes []string
+	db := dbtest.Open(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case dbtest.Match(query, "SELECT * FROM notes") && strings.Contains(query, "FOR SHARE"):
+			return dbtest.Result{
+				Columns: []string{"id", "user_id", "title", "version"},
+				Rows:    [][]driver.Value{{noteID.String(), userID.String(), "Changed elsewhere", int64(4)}},
+			}
+		case dbtest.Match(query, "SELECT * FROM notes"):
+			return dbtest.Result{
+				Columns: []string{"id", "user_id", "title", "version"},
+				Rows:    [][]driver.Value{{noteID.String(), userID.String(), "Original", int64(3)}},
+			}
+		case dbtest.Match(query, "UPDATE notes"):
+			if !strings.Contains(query, "version = ?") {
+				t.Errorf("note write is not conditional: %s", query)
+			}
+			return dbtest.Result{RowsAffected: 0}
+		case dbtest.Match(query, "INSERT"), dbtest.Match(query, "UPDATE"):
+			writes = append(writes, query)
+		}
+		return dbtest.Result{}
+	})
+	h := NewSyncHandler(config.Config{}, db, realtime.NewHub(), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body := `{"notes":{"update":[{"id":"` + noteID.String() + `","base_version":3,"title":"Edited here"}]}}`
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/sync", strings.NewReader(body))
+	c.Set("user_id", userID.String())
+	h.Push(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Results   []syncResult
+			Conflicts []struct {
+				Resolution string
+				Server     struct{ Title string }
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Results) != 1 || resp.Data.Results[0].Status != syncConflicted {
+		t.Fatalf("results = %+v, want one conflict", resp.Data.Results)
+	}
+	if len(resp.Data.Conflicts) != 1 || resp.Data.Conflicts[0].Resolution != policyServerWins || resp.Data.Conflicts[0].Server.Title != "Changed elsewhere" {
+		t.Errorf("conflicts = %+v, want server_wins with the current note", resp.Data.Conflicts)
+	}
+	if len(writes) > 0 {
+		t.Errorf("a lost write still wrote %q", writes)
+	}
+}
+
+// TestMergeNotePlacement checks that a stale push's pin and position are
+// merged against the base revision: a change from one side is kept, and a
+// value the client only echoed back does not undo the server's change.
+func TestMergeNotePlacement(t *testing.T) {
+	yes, no := true, false
+	one, five := 1, 5
+	tests := []struct {
+		name         string
+		basePinned   bool
+		basePosition int
+		server       models.Note
+		client       syncNote
+		wantPinned   bool
+		wantPosition int
+	}{
+		{name: "client pins", client: syncNote{Pinned: &yes}, wantPinned: true},
+		{name: "client moves", client: syncNote{Position: &five}, wantPosition: 5},
+		{name: "omitted keeps the server's", server: models.Note{Pinned: true, Position: 1}, wantPinned: true, wantPosition: 1},
+		{name: "echoed base keeps the server's", basePinned: true, server: models.Note{Position: 1}, client: syncNote{Pinned: &yes, Position: new(int)}, wantPosition: 1},
+		{name: "both moved keeps the server's", server: models.Note{Position: 1}, client: syncNote{Pinned: &no, Position: &five}, wantPosition: 1},
+		{name: "same change on both sides", server: models.Note{Position: 1}, client: syncNote{Position: &one}, wantPosition: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Open(t, func(query string, _ []driver.Value) dbtest.Result {
+				if dbtest.Match(query, "SELECT * FROM note_revisions") {
+					return dbtest.Result{
+						Columns: []string{"title", "content", "version", "pinned", "position"},
+						Rows:    [][]driver.Value{{"Title", "Body", int64(3), tt.basePinned, int64(tt.basePosition)}},
+					}
+				}
+				return dbtest.Result{}
+			})
+			server := tt.server
+			server.ID, server.Title, server.Content, server.Version = uuid.New(), "Title", "Body", 4
+			client := tt.client
+			base := int64(3)
+			client.BaseVersion, client.Title, client.Content = &base, "Title", "Body"
+
+			merged, report, err := (&syncPush{tx: db}).mergeNote(server, client)
+			if err != nil || merged == nil || report != nil {
+				t.Fatalf("mergeNote() = %v, %+v, %v; want a clean merge", merged, report, err)
+			}
+			if merged.Pinned != tt.wantPinned || merged.Position != tt.wantPosition {
+				t.Errorf("pinned, position = %v, %d; want %v, %d", merged.Pinned, merged.Position, tt.wantPinned, tt.wantPosition)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/your-org/notes-api/internal/audit"
+	"github.com/your-org/notes-api/internal/auth"
+)
+
+// throttled refuses a login attempt while the guard holds the account or the
+// client's IP off. It reports whether it has responded.
+func (h *AuthHandler) throttled(c *gin.Context, email string) bool {
+	t, err := h.guard.Check(email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to log in"})
+		return true
+	}
+	if !t.Blocked() {
+		return false
+	}
+	refuseThrottled(c, t)
+	return true
+}
+
+// loginFailed records a failed password or second-factor check and audits
+// any lockout it starts. It reports whether it has responded, which it does
+// when the failure locked the account or IP; otherwise the caller answers
+// with its usual error.
+func (h *AuthHandler) loginFailed(c *gin.Context, email string, userID *uuid.UUID) bool {
+	f, err := h.guard.Fail(email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to log in"})
+		return true
+	}
+	detail := map[string]interface{}{"email": email, "locked_for": int64(f.RetryAfter / time.Second)}
+	if f.AccountLocked {
+		_ = audit.Record(h.db, audit.EventAccountLocked, userID, c.ClientIP(), detail)
+	}
+	if f.IPLocked {
+		_ = audit.Record(h.db, audit.EventIPLocked, nil, c.ClientIP(), detail)
+	}
+	if !f.Locked {
+		return false
+	}
+	refuseThrottled(c, f.Throttle)
+	return true
+}
+
+func refuseThrottled(c *gin.Context, t auth.Throttle) {
+	secs := int64(t.RetryAfter / time.Second)
+	c.Header("Retry-After", strconv.FormatInt(secs, 10))
+	if t.Locked {
+		c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "error": "Too many failed logins; try again later", "code": "ACCOUNT_LOCKED", "retry_after": secs})
+		return
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "error": "Too many failed logins; wait before trying again", "code": "LOGIN_THROTTLED", "retry_after": secs})
+}
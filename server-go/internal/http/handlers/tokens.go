@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// maxTokensPerUser bounds how many live personal access tokens a user holds.
+const maxTokensPerUser = 50
+
+type TokensHandler struct {
+	cfg config.Config
+	db  *gorm.DB
+	v   *validator.Validate
+}
+
+func NewTokensHandler(cfg config.Config, db *gorm.DB) *TokensHandler {
+	return &TokensHandler{cfg: cfg, db: db, v: validator.New()}
+}
+
+type createTokenReq struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+	// ExpiresInDays is optional; tokens without it never expire.
+	ExpiresInDays int `json:"expires_in_days" validate:"min=0,max=3650"`
+}
+
+func (h *TokensHandler) List(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var list []models.PersonalAccessToken
+	if err := h.db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at desc").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"tokens": list, "available_scopes": auth.Scopes}})
+}
+
+// Create issues a token. The raw token is in the response only; the server
+// keeps a hash.
+func (h *TokensHandler) Create(c *gin.Context) {
+	uid := uuid.MustParse(c.GetString("user_id"))
+	var req createTokenReq
+	if err := c.ShouldBindJSON(&req); err != nil || h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, s := range req.Scopes {
+		if !auth.ValidScope(s) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR", "details": gin.H{"scopes": "Unknown scope " + s}})
+			return
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	var count int64
+	if err := h.db.Model(&models.PersonalAccessToken{}).Where("user_id = ? AND revoked_at IS NULL", uid).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create token"})
+		return
+	}
+	if count >= maxTokensPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Too many tokens; revoke one first", "code": "VALIDATION_ERROR"})
+		return
+	}
+	raw, err := auth.NewPAT()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create token"})
+		return
+	}
+	pat := models.PersonalAccessToken{
+		ID:        uuid.New(),
+		UserID:    uid,
+		Name:      req.Name,
+		Prefix:    raw[:len(auth.PATPrefix)+8],
+		TokenHash: auth.HashToken(raw),
+		Scopes:    scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		exp := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		pat.ExpiresAt = &exp
+	}
+	if err := h.db.Create(&pat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create token"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Token created successfully", "data": gin.H{
+		"token":     pat,
+		"raw_token": raw,
+	}})
+}
+
+func (h *TokensHandler) Revoke(c *gin.Context) {
+	userID := c.GetString("user_id")
+	res := h.db.Model(&models.PersonalAccessToken{}).Where("user_id = ? AND id = ? AND revoked_at IS NULL", userID, c.Param("id")).Update("revoked_at", time.Now().UTC())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to revoke token"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Token not found", "code": "TOKEN_NOT_FOUND"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Token revoked successfully"})
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/changelog"
+	"github.com/your-org/notes-api/internal/models"
+	"github.com/your-org/notes-api/internal/trash"
+)
+
+// trashedNote is a note in the trash. PurgeAt is when the purge job will
+// remove it, or nil if trashed notes are kept until the user removes them.
+type trashedNote struct {
+	models.Note
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at"`
+}
+
+// Trash lists deleted notes, most recently deleted first.
+func (h *NotesHandler) Trash(c *gin.Context) {
+	page, ok := queryInt(c, "page", 1, 1, 1<<20)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", 20, 1, 100)
+	if !ok {
+		return
+	}
+	var total int64
+	var notes []models.Note
+	q := h.db.Unscoped().Model(&models.Note{}).Where("user_id = ? AND deleted_at IS NOT NULL", c.GetString("user_id"))
+	err := q.Count(&total).Error
+	if err == nil {
+		err = q.Order("deleted_at desc").Limit(limit).Offset((page - 1) * limit).Find(&notes).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch trash"})
+		return
+	}
+	list := make([]trashedNote, 0, len(notes))
+	for _, n := range notes {
+		t := trashedNote{Note: n, DeletedAt: n.DeletedAt.Time}
+		if h.cfg.TrashRetention > 0 {
+			at := n.DeletedAt.Time.Add(h.cfg.TrashRetention)
+			t.PurgeAt = &at
+		}
+		list = append(list, t)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"notes": list,
+		"pagination": gin.H{
+			"current_page":   page,
+			"total_pages":    (total + int64(limit) - 1) / int64(limit),
+			"total_items":    total,
+			"items_per_page": limit,
+		},
+	}})
+}
+
+// Restore takes a note out of the trash. Like any other change it gets a
+// new version, so clients that saw the delete pick the note up again.
+func (h *NotesHandler) Restore(c *gin.Context) {
+	note, found := h.findTrashed(c)
+	if !found {
+		return
+	}
+	prev := note.Version
+	note.DeletedAt = gorm.DeletedAt{}
+	note.Version++
+	var change models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := writeNote(tx.Unscoped(), &note, prev); err != nil {
+			return err
+		}
+		if err := h.revisions.save(tx, note, authorOf(c)); err != nil {
+			return err
+		}
+		var err error
+		change, err = changelog.Record(tx, note.UserID, changelog.EntityNote, note.ID, changelog.OpUpdate)
+		return err
+	})
+	if errors.Is(err, errNoteChanged) {
+		h.noteChanged(c, note.UserID.String(), note.ID.String(), false)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to restore note"})
+		return
+	}
+	h.hub.Publish(change)
+	setNoteETag(c, note)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Note restored successfully", "data": gin.H{"note": note}})
+}
+
+// DeleteForever permanently deletes one note from the trash, with its
+// revisions and attachments.
+func (h *NotesHandler) DeleteForever(c *gin.Context) {
+	note, found := h.findTrashed(c)
+	if !found {
+		return
+	}
+	deleted, ok := h.purge(c, note.UserID, []uuid.UUID{note.ID})
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Note permanently deleted", "data": gin.H{"deleted_count": deleted}})
+}
+
+// EmptyTrash permanently deletes every note in the trash.
+func (h *NotesHandler) EmptyTrash(c *gin.Context) {
+	uid, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid user id", "code": "TOKEN_INVALID"})
+		return
+	}
+	var ids []uuid.UUID
+	if err := h.db.Unscoped().Model(&models.Note{}).Where("user_id = ? AND deleted_at IS NOT NULL", uid).Pluck("id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to empty trash"})
+		return
+	}
+	deleted := 0
+	if len(ids) > 0 {
+		var ok bool
+		if deleted, ok = h.purge(c, uid, ids); !ok {
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Trash emptied", "data": gin.H{"deleted_count": deleted}})
+}
+
+// purge hard-deletes trashed notes and reports how many, having responded
+// with an error if it failed.
+func (h *NotesHandler) purge(c *gin.Context, uid uuid.UUID, ids []uuid.UUID) (int, bool) {
+	var files []string
+	var changes []models.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		files, changes, err = trash.Purge(tx, uid, ids)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to delete notes"})
+		return 0, false
+	}
+	trash.RemoveFiles(files)
+	h.hub.Publish(changes...)
+	return len(ids), true
+}
+
+func (h *NotesHandler) findTrashed(c *gin.Context) (models.Note, bool) {
+	var note models.Note
+	err := h.db.Unscoped().Where("user_id = ? AND id = ? AND deleted_at IS NOT NULL", c.GetString("user_id"), c.Param("id")).First(&note).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Note not found in trash", "code": "NOTE_NOT_FOUND"})
+		return note, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch note"})
+		return note, false
+	}
+	return note, true
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/devices"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+const (
+	// challengeTTL is how long a user has to enter their second factor
+	// after the password was accepted.
+	challengeTTL      = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type secondFactorReq struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type twoFactorVerifyReq struct {
+	ChallengeToken string `json:"challenge_token"`
+	secondFactorReq
+}
+
+// challenge answers a correct password for a 2FA user with a challenge token
+// instead of a session. The token is a JWT with typ "2fa", which JWTAuth
+// refuses, so it is only good for POST /auth/2fa/verify.
+func (h *AuthHandler) challenge(c *gin.Context, user models.User, info *devices.Info) {
+	claims := jwt.MapClaims{
+		"user_id": user.ID.String(),
+		"typ":     "2fa",
+		"exp":     time.Now().Add(challengeTTL).Unix(),
+	}
+	if info != nil {
+		claims["device"] = info
+	}
+	token, err := h.keys.Sign(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to issue token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication required",
+		"data": gin.H{
+			"two_factor_required": true,
+			"challenge_token":     token,
+			"expires_in":          int64(challengeTTL.Seconds()),
+		},
+	})
+}
+
+// VerifyTwoFactor finishes a 2FA login with a TOTP or recovery code.
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req twoFactorVerifyReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Challenge token and a code are required", "code": "VALIDATION_ERROR"})
+		return
+	}
+	claims, err := h.keys.Parse(req.ChallengeToken)
+	var user models.User
+	if err == nil && claims["typ"] == "2fa" {
+		err = h.db.Where("id = ? AND totp_enabled_at IS NOT NULL", claims["user_id"]).First(&user).Error
+	}
+	if err != nil || claims["typ"] != "2fa" {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Challenge is invalid or has expired; log in again", "code": "TOKEN_INVALID"})
+		return
+	}
+	if !h.verifySecondFactor(c, user, req.secondFactorReq) {
+		return
+	}
+	if err := h.guard.Succeed(user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to verify code"})
+		return
+	}
+	var info *devices.Info
+	if raw, found := claims["device"]; found {
+		b, _ := json.Marshal(raw)
+		info = &devices.Info{}
+		if json.Unmarshal(b, info) != nil {
+			info = nil
+		}
+	}
+	h.completeLogin(c, user, info)
+}
+
+// TwoFactorStatus reports whether 2FA is on and how many recovery codes are
+// left.
+func (h *AuthHandler) TwoFactorStatus(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var user models.User
+	if err := h.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load user"})
+		return
+	}
+	var remaining int64
+	if err := h.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&remaining).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"enabled":                  user.TOTPEnabledAt != nil,
+		"enabled_at":               user.TOTPEnabledAt,
+		"recovery_codes_remaining": remaining,
+	}})
+}
+
+// SetupTwoFactor provisions a new TOTP secret. 2FA is not on until the user
+// proves their authenticator has it, with ConfirmTwoFactor.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	var user models.User
+	if err := h.db.Where("id = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load user"})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Two-factor authentication is already enabled", "code": "TWO_FACTOR_ALREADY_ENABLED"})
+		return
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err == nil {
+		err = h.db.Model(&user).Update("totp_secret", secret).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to set up two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(h.cfg.TOTPIssuer, user.Email, secret),
+	}})
+}
+
+// ConfirmTwoFactor turns 2FA on once the user enters a code from the newly
+// provisioned secret, and returns recovery codes. They are shown only once.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	var req secondFactorReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Code is required", "code": "VALIDATION_ERROR"})
+		return
+	}
+	var user models.User
+	if err := h.db.Where("id = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load user"})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Two-factor authentication is already enabled", "code": "TWO_FACTOR_ALREADY_ENABLED"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Start two-factor setup first", "code": "TWO_FACTOR_NOT_ENABLED"})
+		return
+	}
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid code", "code": "INVALID_2FA_CODE"})
+		return
+	}
+	codes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err == nil {
+		err = h.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(map[string]interface{}{"totp_enabled_at": time.Now().UTC(), "totp_last_step": step}).Error; err != nil {
+				return err
+			}
+			return replaceRecoveryCodes(tx, user.ID, codes)
+		})
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to enable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Two-factor authentication enabled", "data": gin.H{"recovery_codes": codes}})
+}
+
+// DisableTwoFactor turns 2FA off. It needs a current code, so a stolen
+// session alone cannot remove the second factor, and wrong codes count
+// towards the same lockout as a login so the code cannot be guessed.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req secondFactorReq
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "A code is required", "code": "VALIDATION_ERROR"})
+		return
+	}
+	var user models.User
+	if err := h.db.Where("id = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load user"})
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Two-factor authentication is not enabled", "code": "TWO_FACTOR_NOT_ENABLED"})
+		return
+	}
+	if !h.verifySecondFactor(c, user, req) {
+		return
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to disable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Two-factor authentication disabled"})
+}
+
+// verifySecondFactor checks a TOTP or recovery code the way a login checks a
+// password: it is refused while the account or IP is throttled, and a wrong
+// code counts as a failed login. It reports whether the code was accepted;
+// when it was not, it has responded.
+func (h *AuthHandler) verifySecondFactor(c *gin.Context, user models.User, req secondFactorReq) bool {
+	if h.throttled(c, user.Email) {
+		return false
+	}
+	ok, err := h.checkSecondFactor(user, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to verify code"})
+		return false
+	}
+	if !ok {
+		if !h.loginFailed(c, user.Email, &user.ID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid code", "code": "INVALID_2FA_CODE"})
+		}
+		return false
+	}
+	return true
+}
+
+// checkSecondFactor accepts a TOTP code newer than the last one used, or an
+// unused recovery code, and uses it up.
+func (h *AuthHandler) checkSecondFactor(user models.User, req secondFactorReq) (bool, error) {
+	if req.Code != "" {
+		step, ok := auth.ValidateTOTP(user.TOTPSecret, req.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		res := h.db.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+		return res.RowsAffected == 1, res.Error
+	}
+	hash := auth.HashToken(auth.NormalizeRecoveryCode(req.RecoveryCode))
+	res := h.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hash).Update("used_at", time.Now().UTC())
+	return res.RowsAffected == 1, res.Error
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID, codes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	rows := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		rows[i] = models.RecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: auth.HashToken(code)}
+	}
+	return tx.Create(&rows).Error
+}
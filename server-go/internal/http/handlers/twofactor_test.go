@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/dbtest"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+// TestDisableTwoFactorLocksOut checks that guessing recovery codes to turn
+// 2FA off is throttled like a login: the threshold-th wrong code locks the
+// account, and later attempts are refused without checking the code.
+func TestDisableTwoFactorLocksOut(t *testing.T) {
+	userID := uuid.New()
+	checks := 0
+	db := dbtest.Open(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case dbtest.Match(query, "SELECT * FROM users"):
+			return dbtest.Result{
+				Columns: []string{"id", "email", "totp_secret", "totp_enabled_at"},
+				Rows:    [][]driver.Value{{userID.String(), "a@example.com", "JBSWY3DPEHPK3PXP", time.Now()}},
+			}
+		case dbtest.Match(query, "UPDATE recovery_codes"):
+			checks++
+			return dbtest.Result{RowsAffected: 0}
+		}
+		return dbtest.Result{}
+	})
+	cfg := config.Config{
+		LoginFreeAttempts:     10,
+		LoginLockoutThreshold: 3,
+		LoginLockoutDuration:  time.Minute,
+		LoginAttemptWindow:    time.Hour,
+	}
+	h := NewAuthHandler(cfg, db, nil, nil, nil, nil, auth.NewLoginGuard(cfg, auth.NewMemoryAttemptStore()), nil, nil)
+
+	disable := func() (int, string) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/auth/2fa/disable", strings.NewReader(`{"recovery_code":"aaaa-bbbb"}`))
+		c.Set("user_id", userID.String())
+		h.DisableTwoFactor(c)
+		var body struct{ Code string }
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Code
+	}
+
+	for i := 1; i < cfg.LoginLockoutThreshold; i++ {
+		if status, code := disable(); status != http.StatusUnauthorized || code != "INVALID_2FA_CODE" {
+			t.Fatalf("attempt %d = %d %s, want 401 INVALID_2FA_CODE", i, status, code)
+		}
+	}
+	if status, code := disable(); status != http.StatusTooManyRequests || code != "ACCOUNT_LOCKED" {
+		t.Fatalf("attempt at the threshold = %d %s, want 429 ACCOUNT_LOCKED", status, code)
+	}
+	if status, code := disable(); status != http.StatusTooManyRequests || code != "ACCOUNT_LOCKED" {
+		t.Fatalf("attempt while locked = %d %s, want 429 ACCOUNT_LOCKED", status, code)
+	}
+	if checks != cfg.LoginLockoutThreshold {
+		t.Errorf("checked %d codes, want %d: a locked account's code must not be checked", checks, cfg.LoginLockoutThreshold)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/mailer"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// sendVerification emails the user a link to confirm their address.
+func (h *AuthHandler) sendVerification(user models.User) error {
+	token, err := auth.IssueOneTime(h.db, user.ID, auth.PurposeEmailVerification, h.cfg.VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	link := h.cfg.AppURL + "/verify-email?token=" + url.QueryEscape(token)
+	return h.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\nOr enter this code in the app: %s\n\nThe link expires in %s.\n",
+			user.Name, link, token, h.cfg.VerifyEmailTTL),
+	})
+}
+
+// blockedUnverified reports whether the verification policy keeps user from
+// getting tokens at all.
+func (h *AuthHandler) blockedUnverified(user models.User) bool {
+	return user.VerifiedAt == nil && h.cfg.EmailVerification == config.VerificationBlock
+}
+
+// VerifyEmail confirms an address with the token from the verification
+// email, or from the email sent to the new address by ChangeEmail, which
+// switches the account over to it. Clients holding a read-only token should
+// refresh it afterwards.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		t, err := auth.ConsumeOneTime(tx, req.Token, auth.PurposeEmailVerification)
+		if errors.Is(err, auth.ErrOneTimeInvalid) {
+			if t, err = auth.ConsumeOneTime(tx, req.Token, auth.PurposeEmailChange); err != nil {
+				return err
+			}
+			return confirmEmailChange(tx, t)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ? AND verified_at IS NULL", t.UserID).Update("verified_at", time.Now().UTC()).Error
+	})
+	if errors.Is(err, auth.ErrOneTimeInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Verification link is invalid or has expired", "code": "VERIFICATION_TOKEN_INVALID"})
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Email already exists", "code": "EMAIL_EXISTS"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to verify email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Email verified successfully"})
+}
+
+// ResendVerification sends a new verification email. Like ForgotPassword it
+// does not reveal whether the address is registered or already verified.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || h.v.Struct(req) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Validation failed", "code": "VALIDATION_ERROR"})
+		return
+	}
+	// As with ForgotPassword, failures are only logged so that they do not
+	// reveal which addresses are registered.
+	var user models.User
+	if err := h.db.Where("email = ? AND verified_at IS NULL", req.Email).First(&user).Error; err == nil {
+		if err := h.sendVerification(user); err != nil {
+			log.Printf("verification email for user %s: %v", user.ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "If the address needs verifying, a new link has been sent"})
+}
@@ -18,8 +18,9 @@ func CORS(allowOrigins string) gin.HandlerFunc {
 			}
 		}
 		c.Header("Access-Control-Allow-Origin", allow)
-		c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Device-ID, X-Device-Name, X-Device-Platform, X-App-Version, If-Match, If-None-Match")
+		c.Header("Access-Control-Expose-Headers", "ETag")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/devices"
+)
+
+// Device identifies the client a request comes from, by the device_id claim
+// of its token or else the X-Device-ID header. Unknown devices are registered
+// on first use; revoked ones are rejected. Requests without a device ID pass
+// through untouched. Must run after JWTAuth.
+func Device(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.GetString("device_id")
+		if deviceID == "" {
+			deviceID = strings.TrimSpace(c.GetHeader("X-Device-ID"))
+		}
+		if deviceID == "" {
+			c.Next()
+			return
+		}
+		if len(deviceID) > 100 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid device id", "code": "VALIDATION_ERROR"})
+			return
+		}
+		uid, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid user id", "code": "TOKEN_INVALID"})
+			return
+		}
+		d, err := devices.Seen(db, uid, devices.Info{
+			ID:         deviceID,
+			Name:       c.GetHeader("X-Device-Name"),
+			Platform:   c.GetHeader("X-Device-Platform"),
+			AppVersion: c.GetHeader("X-App-Version"),
+		})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to register device"})
+			return
+		}
+		if d.RevokedAt != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Device has been signed out", "code": "DEVICE_REVOKED"})
+			return
+		}
+		c.Set("device_id", deviceID)
+		c.Set("device", d)
+		c.Next()
+	}
+}
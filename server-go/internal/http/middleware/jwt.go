@@ -1,47 +1,107 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/auth"
 )
 
-func JWTAuth(secret string) gin.HandlerFunc {
+// JWTAuth accepts a bearer access token that verifies against keys and is
+// not revoked in store, and sets user_id, token_id and, when the token
+// carries them, device_id and session_id on the context. It also accepts
+// personal access tokens, for which it sets scopes instead; see RequireScope.
+func JWTAuth(keys *auth.KeySet, store auth.RevocationStore, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		auth := c.GetHeader("Authorization")
-		parts := strings.SplitN(auth, " ", 2)
+		header := c.GetHeader("Authorization")
+		parts := strings.SplitN(header, " ", 2)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Missing token", "code": "TOKEN_INVALID"})
 			return
 		}
-		tokenStr := parts[1]
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid token", "code": "TOKEN_INVALID"})
+		if auth.IsPAT(parts[1]) {
+			pat, err := auth.FindPAT(db, parts[1])
+			if errors.Is(err, auth.ErrPATInvalid) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid token", "code": "TOKEN_INVALID"})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to check token"})
+				return
+			}
+			c.Set("user_id", pat.UserID.String())
+			c.Set("token_id", pat.ID.String())
+			c.Set("scopes", pat.Scopes)
+			c.Next()
 			return
 		}
-		// exp check
-		if expVal, ok := claims["exp"]; ok {
-			switch v := expVal.(type) {
-			case float64:
-				if time.Now().Unix() > int64(v) {
-					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Token expired", "code": "TOKEN_EXPIRED"})
-					return
-				}
-			}
+		claims, err := keys.Parse(parts[1])
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Token expired", "code": "TOKEN_EXPIRED"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid token", "code": "TOKEN_INVALID"})
+			return
 		}
 		uid, _ := claims["user_id"].(string)
 		if uid == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Token missing user", "code": "TOKEN_INVALID"})
 			return
 		}
+		userID, err := uuid.Parse(uid)
+		jti, _ := claims["jti"].(string)
+		// Tokens with a typ, such as 2FA challenges, are not access tokens.
+		if typ, _ := claims["typ"].(string); err != nil || jti == "" || typ != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid token", "code": "TOKEN_INVALID"})
+			return
+		}
+		gen, _ := claims["gen"].(float64)
+		current, err := store.Generation(userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid token", "code": "TOKEN_INVALID"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to check token"})
+			return
+		}
+		revoked := int64(gen) < current
+		if !revoked {
+			if revoked, err = store.IsRevoked(jti); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to check token"})
+				return
+			}
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Token has been revoked", "code": "TOKEN_REVOKED"})
+			return
+		}
 		c.Set("user_id", uid)
+		c.Set("token_id", jti)
+		c.Set("token_generation", int64(gen))
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			c.Set("token_expires_at", exp.Time)
+		}
+		if at, _ := claims["auth_time"].(float64); at > 0 {
+			c.Set("auth_time", time.Unix(int64(at), 0))
+		}
+		if sid, _ := claims["sid"].(string); sid != "" {
+			c.Set("session_id", sid)
+		}
+		if ro, _ := claims["ro"].(bool); ro {
+			c.Set("read_only", true)
+		}
+		if did, _ := claims["device_id"].(string); did != "" {
+			c.Set("device_id", did)
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadOnly rejects writes made with a read-only token, which is what users
+// who have not verified their email get under EMAIL_VERIFICATION=read_only.
+// Routes in allow, given as "METHOD /path" such as "POST /v1/auth/logout",
+// stay open; other methods on the same path do not. Must run after JWTAuth.
+func ReadOnly(allow ...string) gin.HandlerFunc {
+	open := map[string]bool{}
+	for _, r := range allow {
+		open[r] = true
+	}
+	return func(c *gin.Context) {
+		if !c.GetBool("read_only") || open[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+		default:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "error": "Verify your email address to make changes", "code": "EMAIL_NOT_VERIFIED"})
+		}
+	}
+}
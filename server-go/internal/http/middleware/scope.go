@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope limits a route to personal access tokens granted scope.
+// Session tokens from login carry no scopes and may use every route.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, isPAT := c.Get("scopes")
+		if !isPAT {
+			c.Next()
+			return
+		}
+		scopes, _ := v.([]string)
+		for _, s := range scopes {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "error": "Token is missing the " + scope + " scope", "code": "INSUFFICIENT_SCOPE"})
+	}
+}
+
+// SessionOnly keeps personal access tokens away from routes that manage the
+// account itself, such as logout, 2FA and the tokens themselves.
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isPAT := c.Get("scopes"); isPAT {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "error": "Personal access tokens cannot use this endpoint", "code": "INSUFFICIENT_SCOPE"})
+			return
+		}
+		c.Next()
+	}
+}
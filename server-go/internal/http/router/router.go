@@ -7,13 +7,24 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"github.com/your-org/notes-api/internal/auth"
 	"github.com/your-org/notes-api/internal/config"
 	"github.com/your-org/notes-api/internal/http/handlers"
 	"github.com/your-org/notes-api/internal/http/middleware"
+	"github.com/your-org/notes-api/internal/mailer"
+	"github.com/your-org/notes-api/internal/oidc"
+	"github.com/your-org/notes-api/internal/password"
+	"github.com/your-org/notes-api/internal/realtime"
 )
 
-func New(cfg config.Config, db *gorm.DB) *gin.Engine {
+func New(cfg config.Config, db *gorm.DB, keys *auth.KeySet, mail mailer.Mailer, passwords password.Hasher, policy *password.Policy) (*gin.Engine, error) {
 	r := gin.New()
+	// Login limits are keyed on the client IP, so forwarding headers are
+	// only believed from configured proxies; gin trusts every peer by
+	// default.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
 	r.Use(gin.Recovery())
 	r.Use(middleware.Logger())
 	r.Use(middleware.CORS(cfg.CORSAllowOrigins))
@@ -22,7 +33,11 @@ func New(cfg config.Config, db *gorm.DB) *gin.Engine {
 		c.JSON(http.StatusOK, gin.H{"status": "ok", "time": time.Now().UTC()})
 	})
 
-	r.Static("/files", cfg.StorageDir)
+	revocations := auth.NewRevocationStore(db)
+	attempts := auth.NewMemoryAttemptStore()
+	if cfg.LoginAttemptStore == "db" {
+		attempts = auth.NewDBAttemptStore(db)
+	}
 
 	api := r.Group("/v1")
 	{
@@ -30,41 +45,91 @@ func New(cfg config.Config, db *gorm.DB) *gin.Engine {
 			c.JSON(http.StatusOK, gin.H{"status": "ok", "time": time.Now().UTC()})
 		})
 
-		auth := handlers.NewAuthHandler(cfg, db)
-		notes := handlers.NewNotesHandler(cfg, db)
-		cats := handlers.NewCategoriesHandler(cfg, db)
+		hub := realtime.NewHub()
+		authH := handlers.NewAuthHandler(cfg, db, keys, revocations, mail, oidc.NewRegistry(cfg.OIDCProviders, nil), auth.NewLoginGuard(cfg, attempts), passwords, policy)
+		notes := handlers.NewNotesHandler(cfg, db, hub)
+		cats := handlers.NewCategoriesHandler(cfg, db, hub)
 		search := handlers.NewSearchHandler(cfg, db)
-		sync := handlers.NewSyncHandler(cfg, db)
-		attach := handlers.NewAttachmentsHandler(cfg, db)
+		sync := handlers.NewSyncHandler(cfg, db, hub, revocations)
+		attach := handlers.NewAttachmentsHandler(cfg, db, hub)
+		devices := handlers.NewDevicesHandler(cfg, db)
+		tokens := handlers.NewTokensHandler(cfg, db)
+		session := middleware.SessionOnly()
+
+		r.GET("/.well-known/jwks.json", authH.JWKS)
 
-		api.POST("/auth/register", auth.Register)
-		api.POST("/auth/login", auth.Login)
+		api.POST("/auth/register", authH.Register)
+		api.POST("/auth/login", authH.Login)
+		api.POST("/auth/refresh", authH.Refresh)
+		api.POST("/auth/forgot-password", authH.ForgotPassword)
+		api.POST("/auth/reset-password", authH.ResetPassword)
+		api.POST("/auth/verify-email", authH.VerifyEmail)
+		api.POST("/auth/resend-verification", authH.ResendVerification)
+		api.POST("/auth/2fa/verify", authH.VerifyTwoFactor)
+		api.GET("/auth/oidc", authH.OIDCProviders)
+		api.POST("/auth/oidc/:provider/start", authH.OIDCStart)
+		api.GET("/auth/oidc/:provider/callback", authH.OIDCCallback)
+		api.POST("/auth/oidc/:provider/callback", authH.OIDCCallback)
 
-		api.Use(middleware.JWTAuth(cfg.JWTSecret))
+		api.Use(middleware.JWTAuth(keys, revocations, db))
+		api.Use(middleware.Device(db))
+		// Unverified users may still fix a mistyped address or leave.
+		api.Use(middleware.ReadOnly("POST /v1/auth/logout", "POST /v1/auth/logout-all", "POST /v1/me/email", "DELETE /v1/me"))
 		{
-			api.POST("/auth/logout", auth.Logout)
+			api.POST("/auth/logout", session, authH.Logout)
+			api.POST("/auth/logout-all", session, authH.LogoutAll)
+			api.GET("/auth/2fa", session, authH.TwoFactorStatus)
+			api.POST("/auth/2fa/setup", session, authH.SetupTwoFactor)
+			api.POST("/auth/2fa/confirm", session, authH.ConfirmTwoFactor)
+			api.POST("/auth/2fa/disable", session, authH.DisableTwoFactor)
+
+			api.GET("/me", authH.Me)
+			api.PATCH("/me", session, authH.UpdateMe)
+			api.DELETE("/me", session, authH.DeleteMe)
+			api.POST("/me/password", session, authH.ChangePassword)
+			api.POST("/me/email", session, authH.ChangeEmail)
+
+			api.GET("/notes", middleware.RequireScope(auth.ScopeNotesRead), notes.List)
+			api.GET("/notes/:id", middleware.RequireScope(auth.ScopeNotesRead), notes.Get)
+			api.POST("/notes", middleware.RequireScope(auth.ScopeNotesWrite), notes.Create)
+			api.PUT("/notes/:id", middleware.RequireScope(auth.ScopeNotesWrite), notes.Update)
+			api.PATCH("/notes/:id", middleware.RequireScope(auth.ScopeNotesWrite), notes.Patch)
+			api.DELETE("/notes/:id", middleware.RequireScope(auth.ScopeNotesWrite), notes.Delete)
+			api.POST("/notes/:id/archive", middleware.RequireScope(auth.ScopeNotesWrite), notes.Archive)
+			api.POST("/notes/:id/restore", middleware.RequireScope(auth.ScopeNotesWrite), notes.Restore)
+			api.GET("/trash", middleware.RequireScope(auth.ScopeNotesRead), notes.Trash)
+			api.DELETE("/trash", middleware.RequireScope(auth.ScopeNotesWrite), notes.EmptyTrash)
+			api.DELETE("/trash/:id", middleware.RequireScope(auth.ScopeNotesWrite), notes.DeleteForever)
+			api.GET("/notes/:id/revisions", middleware.RequireScope(auth.ScopeNotesRead), notes.Revisions)
+			api.GET("/notes/:id/revisions/diff", middleware.RequireScope(auth.ScopeNotesRead), notes.DiffRevisions)
+			api.GET("/notes/:id/revisions/:version", middleware.RequireScope(auth.ScopeNotesRead), notes.Revision)
+			api.POST("/notes/:id/revisions/:version/restore", middleware.RequireScope(auth.ScopeNotesWrite), notes.RestoreRevision)
+			api.POST("/notes/bulk-delete", middleware.RequireScope(auth.ScopeNotesWrite), notes.BulkDelete)
+
+			api.GET("/categories", middleware.RequireScope(auth.ScopeCategoriesRead), cats.List)
+			api.POST("/categories", middleware.RequireScope(auth.ScopeCategoriesWrite), cats.Create)
+			api.PUT("/categories/:id", middleware.RequireScope(auth.ScopeCategoriesWrite), cats.Update)
+			api.PATCH("/categories/:id", middleware.RequireScope(auth.ScopeCategoriesWrite), cats.Patch)
+			api.DELETE("/categories/:id", middleware.RequireScope(auth.ScopeCategoriesWrite), cats.Delete)
 
-			api.GET("/notes", notes.List)
-			api.GET("/notes/:id", notes.Get)
-			api.POST("/notes", notes.Create)
-			api.PUT("/notes/:id", notes.Update)
-			api.DELETE("/notes/:id", notes.Delete)
-			api.POST("/notes/:id/archive", notes.Archive)
-			api.POST("/notes/bulk-delete", notes.BulkDelete)
+			api.GET("/search", middleware.RequireScope(auth.ScopeNotesRead), search.Search)
 
-			api.GET("/categories", cats.List)
-			api.POST("/categories", cats.Create)
-			api.PUT("/categories/:id", cats.Update)
-			api.DELETE("/categories/:id", cats.Delete)
+			api.GET("/sync", middleware.RequireScope(auth.ScopeSync), sync.Pull)
+			api.POST("/sync", middleware.RequireScope(auth.ScopeSync), sync.Push)
+			api.GET("/sync/stream", middleware.RequireScope(auth.ScopeSync), sync.Stream)
 
-			api.GET("/search", search.Search)
+			api.POST("/notes/:id/attachments", middleware.RequireScope(auth.ScopeAttachmentsWrite), attach.Upload)
+			api.POST("/attachments", middleware.RequireScope(auth.ScopeAttachmentsWrite), attach.Stage)
+			api.GET("/attachments/:id", middleware.RequireScope(auth.ScopeAttachmentsRead), attach.Download)
+			api.DELETE("/attachments/:id", middleware.RequireScope(auth.ScopeAttachmentsWrite), attach.Delete)
 
-			api.GET("/sync", sync.Pull)
-			api.POST("/sync", sync.Push)
+			api.GET("/devices", session, devices.List)
+			api.DELETE("/devices/:id", session, devices.Revoke)
 
-			api.POST("/notes/:id/attachments", attach.Upload)
-			api.DELETE("/attachments/:id", attach.Delete)
+			api.GET("/tokens", session, tokens.List)
+			api.POST("/tokens", session, tokens.Create)
+			api.DELETE("/tokens/:id", session, tokens.Revoke)
 		}
 	}
-	return r
+	return r, nil
 }
@@ -0,0 +1,121 @@
+package router
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/your-org/notes-api/internal/auth"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/dbtest"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+// TestClientIPIgnoresSpoofedForwarding checks the address that login limits
+// are keyed on: X-Forwarded-For only counts when the peer is a configured
+// proxy.
+func TestClientIPIgnoresSpoofedForwarding(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{name: "no trusted proxies", want: "192.0.2.10"},
+		{name: "peer is not a trusted proxy", proxies: []string{"198.51.100.0/24"}, want: "192.0.2.10"},
+		{name: "peer is a trusted proxy", proxies: []string{"192.0.2.10"}, want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Open(t, func(string, []driver.Value) dbtest.Result { return dbtest.Result{} })
+			r, err := New(config.Config{TrustedProxies: tt.proxies}, db, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = "192.0.2.10:4711"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("X-Real-IP", "203.0.113.8")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidProxy(t *testing.T) {
+	db := dbtest.Open(t, func(string, []driver.Value) dbtest.Result { return dbtest.Result{} })
+	if _, err := New(config.Config{TrustedProxies: []string{"not-an-ip"}}, db, nil, nil, nil, nil); err == nil {
+		t.Error("New() accepted an invalid TRUSTED_PROXIES entry")
+	}
+}
+
+// TestReadOnlyAllowList checks which routes a read-only token, as issued to
+// unverified users, may still write to. The allow-list is per method, so
+// being able to delete the account does not mean being able to edit it.
+func TestReadOnlyAllowList(t *testing.T) {
+	cfg := config.Config{AppEnv: "dev", JWTAlgorithm: "HS256", JWTSecret: "test-secret"}
+	keys, err := auth.LoadKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := keys.Sign(jwt.MapClaims{
+		"user_id": uuid.NewString(),
+		"jti":     uuid.NewString(),
+		"gen":     0,
+		"ro":      true,
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := dbtest.Open(t, func(query string, _ []driver.Value) dbtest.Result {
+		if dbtest.Match(query, "SELECT token_generation FROM users") {
+			return dbtest.Result{Columns: []string{"token_generation"}, Rows: [][]driver.Value{{int64(0)}}}
+		}
+		return dbtest.Result{}
+	})
+	r, err := New(cfg, db, keys, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method  string
+		path    string
+		blocked bool
+	}{
+		{method: http.MethodGet, path: "/v1/me"},
+		{method: http.MethodPatch, path: "/v1/me", blocked: true},
+		{method: http.MethodDelete, path: "/v1/me"},
+		{method: http.MethodPost, path: "/v1/me/email"},
+		{method: http.MethodPost, path: "/v1/me/password", blocked: true},
+		{method: http.MethodPost, path: "/v1/auth/logout"},
+		{method: http.MethodPost, path: "/v1/notes", blocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var body struct{ Code string }
+			_ = json.Unmarshal(w.Body.Bytes(), &body)
+			if got := body.Code == "EMAIL_NOT_VERIFIED"; got != tt.blocked {
+				t.Errorf("blocked = %v, want %v; got %d %s", got, tt.blocked, w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package merge
+
+// Line operations in a Diff.
+const (
+	OpEqual  = "="
+	OpDelete = "-"
+	OpInsert = "+"
+)
+
+// Line is one line of a diff: kept, deleted from the old text or inserted
+// in the new one.
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Diff returns a line diff that turns old into new, based on the same
+// longest common subsequence as Merge. Deletions come before insertions
+// within a changed region.
+func Diff(old, new string) []Line {
+	a, b := splitLines(old), splitLines(new)
+	out := []Line{}
+	i, j := 0, 0
+	for _, p := range lcs(a, b) {
+		for ; i < p[0]; i++ {
+			out = append(out, Line{Op: OpDelete, Text: a[i]})
+		}
+		for ; j < p[1]; j++ {
+			out = append(out, Line{Op: OpInsert, Text: b[j]})
+		}
+		out = append(out, Line{Op: OpEqual, Text: a[i]})
+		i, j = i+1, j+1
+	}
+	for ; i < len(a); i++ {
+		out = append(out, Line{Op: OpDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, Line{Op: OpInsert, Text: b[j]})
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package merge
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Line
+	}{
+		{
+			name: "both empty",
+			want: []Line{},
+		},
+		{
+			name: "insert into empty",
+			new:  "a",
+			want: []Line{{OpInsert, "a"}},
+		},
+		{
+			name: "replace middle line",
+			old:  "a\nb\nc", new: "a\nB\nc",
+			want: []Line{{OpEqual, "a"}, {OpDelete, "b"}, {OpInsert, "B"}, {OpEqual, "c"}},
+		},
+		{
+			name: "delete and append",
+			old:  "a\nb\nc", new: "a\nc\nd",
+			want: []Line{{OpEqual, "a"}, {OpDelete, "b"}, {OpEqual, "c"}, {OpInsert, "d"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLargeRegionIsReplaced(t *testing.T) {
+	n := maxRegionLines + 1
+	old, new := numbered("x", n), numbered("x", n)
+	for i := 0; i < n; i += 2 {
+		new[i] = "y" + strconv.Itoa(i)
+	}
+	got := Diff(strings.Join(old, "\n"), strings.Join(new, "\n"))
+	// The first and last lines differ, so nothing is trimmed and no line in
+	// between is matched.
+	if len(got) != 2*n {
+		t.Fatalf("got %d lines, want %d", len(got), 2*n)
+	}
+	for i, l := range got {
+		want := OpDelete
+		if i >= n {
+			want = OpInsert
+		}
+		if l.Op != want {
+			t.Fatalf("line %d is %q, want %q", i, l.Op, want)
+		}
+	}
+}
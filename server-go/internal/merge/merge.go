@@ -0,0 +1,202 @@
+// Package merge implements a line-based three-way merge in the style of
+// diff3. It is used by sync to combine concurrent edits of a note made from
+// a common base revision, and its line diff shows how revisions differ.
+package merge
+
+import "strings"
+
+// Conflict is a region that both sides changed differently. BaseStart is the
+// zero-based line in base where the region begins.
+type Conflict struct {
+	BaseStart int
+	Base      []string
+	Ours      []string
+	Theirs    []string
+}
+
+// chunk is a piece of merged output: either resolved lines or, when
+// conflict is not negative, the index of a conflict in Result.Conflicts.
+type chunk struct {
+	lines    []string
+	conflict int
+}
+
+// Result is the outcome of a merge.
+type Result struct {
+	chunks    []chunk
+	Conflicts []Conflict
+}
+
+// Clean reports whether the merge succeeded without conflicts.
+func (r Result) Clean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// Text returns the merged text. Conflicting regions are rendered with
+// diff3-style markers using the given labels for each side.
+func (r Result) Text(oursLabel, theirsLabel string) string {
+	var out []string
+	for _, c := range r.chunks {
+		if c.conflict < 0 {
+			out = append(out, c.lines...)
+			continue
+		}
+		conflict := r.Conflicts[c.conflict]
+		out = append(out, "<<<<<<< "+oursLabel)
+		out = append(out, conflict.Ours...)
+		out = append(out, "||||||| base")
+		out = append(out, conflict.Base...)
+		out = append(out, "=======")
+		out = append(out, conflict.Theirs...)
+		out = append(out, ">>>>>>> "+theirsLabel)
+	}
+	return strings.Join(out, "\n")
+}
+
+// Merge combines the changes ours and theirs each made to base. Regions
+// changed on only one side, or changed identically on both, are taken as is.
+func Merge(base, ours, theirs string) Result {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	mo, mt := matches(b, o), matches(b, t)
+
+	var res Result
+	emit := func(lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		if n := len(res.chunks); n > 0 && res.chunks[n-1].conflict < 0 {
+			res.chunks[n-1].lines = append(res.chunks[n-1].lines, lines...)
+			return
+		}
+		res.chunks = append(res.chunks, chunk{lines: append([]string{}, lines...), conflict: -1})
+	}
+
+	i, io, it := 0, 0, 0
+	for i < len(b) || io < len(o) || it < len(t) {
+		// A base line kept in place by both sides is stable.
+		if i < len(b) && mo[i] == io && mt[i] == it {
+			emit(b[i : i+1])
+			i, io, it = i+1, io+1, it+1
+			continue
+		}
+		// Otherwise the unstable region runs up to the next base line that
+		// both sides kept, or to the end of all three inputs.
+		j, jo, jt := len(b), len(o), len(t)
+		for k := i; k < len(b); k++ {
+			if mo[k] >= 0 && mt[k] >= 0 {
+				j, jo, jt = k, mo[k], mt[k]
+				break
+			}
+		}
+		bc, oc, tc := b[i:j], o[io:jo], t[it:jt]
+		switch {
+		case equal(oc, bc):
+			emit(tc)
+		case equal(tc, bc), equal(oc, tc):
+			emit(oc)
+		default:
+			res.chunks = append(res.chunks, chunk{conflict: len(res.Conflicts)})
+			res.Conflicts = append(res.Conflicts, Conflict{
+				BaseStart: i,
+				Base:      append([]string{}, bc...),
+				Ours:      append([]string{}, oc...),
+				Theirs:    append([]string{}, tc...),
+			})
+		}
+		i, io, it = j, jo, jt
+	}
+	return res
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns, for every line of a, the index of the line in b it is
+// paired with by a longest common subsequence, or -1.
+func matches(a, b []string) []int {
+	m := make([]int, len(a))
+	for i := range m {
+		m[i] = -1
+	}
+	for _, p := range lcs(a, b) {
+		m[p[0]] = p[1]
+	}
+	return m
+}
+
+// Limits on the changed region lcs builds its table for. Past either one
+// the region is left unmatched, so Merge reports it as a single conflict and
+// Diff as a wholesale replacement, rather than allocating len(a)*len(b) ints.
+const (
+	maxRegionLines = 5000
+	maxRegionCells = 1 << 22
+)
+
+// lcs returns the index pairs of a longest common subsequence of a and b.
+// Common prefixes and suffixes are trimmed first so that the quadratic table
+// only covers the region that actually changed.
+func lcs(a, b []string) [][2]int {
+	var pairs [][2]int
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pairs = append(pairs, [2]int{pre, pre})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma) > maxRegionLines || len(mb) > maxRegionLines || len(ma)*len(mb) > maxRegionCells {
+		ma, mb = nil, nil
+	}
+
+	// table[i][j] is the LCS length of ma[i:] and mb[j:].
+	table := make([][]int, len(ma)+1)
+	for i := range table {
+		table[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else if table[i+1][j] >= table[i][j+1] {
+				table[i][j] = table[i+1][j]
+			} else {
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+	for i, j := 0, 0; i < len(ma) && j < len(mb); {
+		switch {
+		case ma[i] == mb[j]:
+			pairs = append(pairs, [2]int{pre + i, pre + j})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	for k := suf; k > 0; k-- {
+		pairs = append(pairs, [2]int{len(a) - k, len(b) - k})
+	}
+	return pairs
+}
@@ -0,0 +1,124 @@
+package merge
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          []Conflict
+	}{
+		{
+			name: "unchanged",
+			base: "a\nb\nc", ours: "a\nb\nc", theirs: "a\nb\nc",
+			want: "a\nb\nc",
+		},
+		{
+			name: "clean, different regions",
+			base: "a\nb\nc\nd\ne", ours: "A\nb\nc\nd\ne", theirs: "a\nb\nc\nd\nE",
+			want: "A\nb\nc\nd\nE",
+		},
+		{
+			name: "ours only",
+			base: "a\nb\nc", ours: "a\nB\nc", theirs: "a\nb\nc",
+			want: "a\nB\nc",
+		},
+		{
+			name: "theirs only",
+			base: "a\nb\nc", ours: "a\nb\nc", theirs: "a\nb\nc\nd",
+			want: "a\nb\nc\nd",
+		},
+		{
+			name: "same change on both sides",
+			base: "a\nb\nc", ours: "a\nX\nc", theirs: "a\nX\nc",
+			want: "a\nX\nc",
+		},
+		{
+			name: "both sides change the same line",
+			base: "a\nb\nc", ours: "a\nours\nc", theirs: "a\ntheirs\nc",
+			want: "a\n<<<<<<< ours\nours\n||||||| base\nb\n=======\ntheirs\n>>>>>>> theirs\nc",
+			conflicts: []Conflict{
+				{BaseStart: 1, Base: []string{"b"}, Ours: []string{"ours"}, Theirs: []string{"theirs"}},
+			},
+		},
+		{
+			name: "one side deletes what the other edits",
+			base: "a\nb\nc", ours: "a\nc", theirs: "a\nB\nc",
+			want: "a\n<<<<<<< ours\n||||||| base\nb\n=======\nB\n>>>>>>> theirs\nc",
+			conflicts: []Conflict{
+				{BaseStart: 1, Base: []string{"b"}, Ours: []string{}, Theirs: []string{"B"}},
+			},
+		},
+		{
+			name: "empty base, one side adds",
+			base: "", ours: "", theirs: "new",
+			want: "new",
+		},
+		{
+			name: "empty base, both add the same",
+			base: "", ours: "x\ny", theirs: "x\ny",
+			want: "x\ny",
+		},
+		{
+			name: "empty base, both add differently",
+			base: "", ours: "x", theirs: "y",
+			want: "<<<<<<< ours\nx\n||||||| base\n=======\ny\n>>>>>>> theirs",
+			conflicts: []Conflict{
+				{BaseStart: 0, Base: []string{}, Ours: []string{"x"}, Theirs: []string{"y"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Merge(tt.base, tt.ours, tt.theirs)
+			if got := res.Text("ours", "theirs"); got != tt.want {
+				t.Errorf("Text() = %q, want %q", got, tt.want)
+			}
+			if res.Clean() != (len(tt.conflicts) == 0) {
+				t.Errorf("Clean() = %v with conflicts %+v", res.Clean(), res.Conflicts)
+			}
+			if len(tt.conflicts) > 0 && !reflect.DeepEqual(res.Conflicts, tt.conflicts) {
+				t.Errorf("Conflicts = %+v, want %+v", res.Conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+// numbered returns n lines, each prefixed so that they differ from the
+// lines of any other prefix.
+func numbered(prefix string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = prefix + strconv.Itoa(i)
+	}
+	return lines
+}
+
+func TestMergeLargeRegionIsOneConflict(t *testing.T) {
+	// Every other line changes on both sides, which would be many small
+	// conflicts if the region were small enough to diff.
+	n := maxRegionLines + 1
+	b, o, th := numbered("b", n), numbered("b", n), numbered("b", n)
+	for i := 0; i < n; i += 2 {
+		o[i] = "o" + strconv.Itoa(i)
+		th[i] = "t" + strconv.Itoa(i)
+	}
+	head, tail := "same head", "same tail"
+	join := func(lines []string) string {
+		return head + "\n" + strings.Join(lines, "\n") + "\n" + tail
+	}
+	res := Merge(join(b), join(o), join(th))
+	if len(res.Conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(res.Conflicts))
+	}
+	c := res.Conflicts[0]
+	if c.BaseStart != 1 || len(c.Base) != n || len(c.Ours) != n || len(c.Theirs) != n {
+		t.Errorf("conflict covers base %d+%d, ours %d, theirs %d; want 1+%d each", c.BaseStart, len(c.Base), len(c.Ours), len(c.Theirs), n)
+	}
+}
@@ -12,8 +12,18 @@ type User struct {
 	Name         string    `gorm:"size:100;not null" json:"name"`
 	Email        string    `gorm:"size:255;uniqueIndex;not null" json:"email"`
 	PasswordHash string    `gorm:"size:255;not null" json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// VerifiedAt is when the user confirmed their email address.
+	VerifiedAt *time.Time `json:"verified_at"`
+	// TOTPSecret is set while two-factor setup is pending and after it is
+	// confirmed; TOTPEnabledAt marks confirmation. TOTPLastStep is the time
+	// step of the last accepted code, which cannot be used again.
+	TOTPSecret    string     `gorm:"size:64" json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	TOTPLastStep  int64      `gorm:"not null;default:0" json:"-"`
+	// TokenGeneration is bumped to invalidate every token issued so far.
+	TokenGeneration int64     `gorm:"not null;default:0" json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 type Category struct {
@@ -21,29 +31,223 @@ type Category struct {
 	UserID    uuid.UUID `gorm:"type:char(36);index;not null" json:"user_id"`
 	Name      string    `gorm:"size:50;not null" json:"name"`
 	Color     *string   `gorm:"size:7" json:"color"`
+	Version   int64     `gorm:"not null;default:1" json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Note struct {
-	ID        uuid.UUID      `gorm:"type:char(36);primaryKey" json:"id"`
-	UserID    uuid.UUID      `gorm:"type:char(36);index;not null" json:"user_id"`
-	Title     string         `gorm:"size:200;not null" json:"title"`
-	Content   string         `gorm:"type:text" json:"content"`
-	Category  *string        `gorm:"size:50" json:"category"`
-	Tags      []string       `gorm:"type:json;serializer:json" json:"tags"`
-	Archived  bool           `gorm:"type:tinyint(1);default:0" json:"archived"`
+	ID       uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID   uuid.UUID `gorm:"type:char(36);index;not null" json:"user_id"`
+	Title    string    `gorm:"size:200;not null" json:"title"`
+	Content  string    `gorm:"type:text" json:"content"`
+	Category *string   `gorm:"size:50" json:"category"`
+	Tags     []string  `gorm:"type:json;serializer:json" json:"tags"`
+	Archived bool      `gorm:"type:tinyint(1);default:0" json:"archived"`
+	Pinned   bool      `gorm:"type:tinyint(1);default:0" json:"pinned"`
+	// Position orders notes for sort=position; clients pick the values.
+	Position  int            `gorm:"not null;default:0" json:"position"`
+	Version   int64          `gorm:"not null;default:1" json:"version"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// NoteRevision is an immutable snapshot of a note as of one version,
+// recorded by every write. Sync uses the revision a client based its edit on
+// as the base of a three-way merge. AuthorID and DeviceID say who made the
+// change and from where; RestoredFrom is set when the write restored an
+// older revision.
+type NoteRevision struct {
+	ID           uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	NoteID       uuid.UUID  `gorm:"type:char(36);uniqueIndex:idx_note_revision;not null" json:"note_id"`
+	UserID       uuid.UUID  `gorm:"type:char(36);index;not null" json:"user_id"`
+	Version      int64      `gorm:"uniqueIndex:idx_note_revision;not null" json:"version"`
+	Title        string     `gorm:"size:200;not null" json:"title"`
+	Content      string     `gorm:"type:text" json:"content"`
+	Category     *string    `gorm:"size:50" json:"category"`
+	Tags         []string   `gorm:"type:json;serializer:json" json:"tags"`
+	Archived     bool       `gorm:"type:tinyint(1);default:0" json:"archived"`
+	Pinned       bool       `gorm:"type:tinyint(1);default:0" json:"pinned"`
+	Position     int        `gorm:"not null;default:0" json:"position"`
+	AuthorID     *uuid.UUID `gorm:"type:char(36)" json:"author_id"`
+	DeviceID     string     `gorm:"size:100" json:"device_id"`
+	RestoredFrom *int64     `json:"restored_from"`
+	CreatedAt    time.Time  `gorm:"index" json:"created_at"`
+}
+
+// SyncMutation remembers a client mutation ID that a sync push applied,
+// together with the JSON-encoded outcome returned for it, so retried pushes
+// are answered from here instead of being applied twice.
+type SyncMutation struct {
+	UserID     uuid.UUID `gorm:"type:char(36);primaryKey"`
+	MutationID string    `gorm:"size:64;primaryKey"`
+	Outcome    string    `gorm:"type:text;not null"`
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+// SyncCounter holds the last change sequence number handed out for a user.
+// Tombstones up to PurgedSeq have been removed from the change log, so a
+// cursor older than that can no longer be served incrementally.
+type SyncCounter struct {
+	UserID    uuid.UUID `gorm:"type:char(36);primaryKey"`
+	Seq       uint64    `gorm:"not null"`
+	PurgedSeq uint64    `gorm:"not null;default:0"`
+}
+
+// Change is one entry in a user's change log: entity EntityID was created,
+// updated or deleted at sequence number Seq.
+type Change struct {
+	UserID    uuid.UUID `gorm:"type:char(36);primaryKey;autoIncrement:false" json:"-"`
+	Seq       uint64    `gorm:"primaryKey;autoIncrement:false" json:"seq"`
+	Entity    string    `gorm:"size:20;not null;index:idx_change_entity" json:"entity"`
+	EntityID  uuid.UUID `gorm:"type:char(36);not null;index:idx_change_entity" json:"entity_id"`
+	Op        string    `gorm:"size:10;not null" json:"op"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Device is a client a user syncs from. DeviceID is chosen by the client;
+// AckedSeq is the last change sequence number the device acknowledged.
+type Device struct {
+	ID         uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:char(36);uniqueIndex:idx_user_device;not null" json:"-"`
+	DeviceID   string     `gorm:"size:100;uniqueIndex:idx_user_device;not null" json:"device_id"`
+	Name       string     `gorm:"size:100" json:"name"`
+	Platform   string     `gorm:"size:50" json:"platform"`
+	AppVersion string     `gorm:"size:50" json:"app_version"`
+	AckedSeq   uint64     `gorm:"not null;default:0" json:"-"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Attachment is a file stored under STORAGE_DIR. NoteID is nil while an
+// upload is staged, waiting for a sync push to bind it to a note that may not
+// have existed on the server at upload time.
 type Attachment struct {
-	ID          uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
-	NoteID      uuid.UUID `gorm:"type:char(36);index;not null" json:"note_id"`
-	FileName    string    `gorm:"size:255;not null" json:"file_name"`
-	MimeType    string    `gorm:"size:100;not null" json:"mime_type"`
-	Size        int64     `gorm:"not null" json:"size"`
-	StoragePath string    `gorm:"size:512;not null" json:"storage_path"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:char(36);index;not null" json:"-"`
+	NoteID      *uuid.UUID `gorm:"type:char(36);index" json:"note_id"`
+	FileName    string     `gorm:"size:255;not null" json:"file_name"`
+	MimeType    string     `gorm:"size:100;not null" json:"mime_type"`
+	Size        int64      `gorm:"not null" json:"size"`
+	StoragePath string     `gorm:"size:512;not null" json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// RefreshToken is a server-side record of a refresh token. Only a hash of the
+// token is stored. Each refresh rotates the token: the old row is marked
+// RotatedAt and a new one is issued in the same FamilyID, so a rotated token
+// turning up again means it was copied. AuthTime is when the user logged in
+// to start the family; rotation carries it over.
+type RefreshToken struct {
+	ID        uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:char(36);index;not null" json:"-"`
+	FamilyID  uuid.UUID  `gorm:"type:char(36);index;not null" json:"-"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	DeviceID  string     `gorm:"size:100;index" json:"device_id"`
+	AuthTime  *time.Time `json:"-"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RevokedToken is an access token, identified by its jti claim, that was
+// revoked before it expired. Rows are dropped once ExpiresAt has passed.
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;size:36;primaryKey" json:"jti"`
+	UserID    uuid.UUID `gorm:"type:char(36);index;not null" json:"-"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OneTimeToken is a single-use token sent by email, such as a password reset
+// link. Only a hash is stored; Purpose keeps a token from being used for
+// anything else.
+type OneTimeToken struct {
+	ID        uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:char(36);index;not null" json:"-"`
+	Purpose   string    `gorm:"size:30;not null" json:"purpose"`
+	TokenHash string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	// Data carries what the token confirms, such as the new address for an
+	// email change.
+	Data      string     `gorm:"size:255" json:"-"`
+	ExpiresAt time.Time  `gorm:"index;not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RecoveryCode is a hashed single-use code that stands in for a TOTP code
+// when the user has lost their authenticator.
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:char(36);index;not null" json:"-"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PersonalAccessToken is a long-lived, named token for scripts and
+// integrations, limited to Scopes. Only a hash is stored; Prefix is the start
+// of the token, kept so users can tell their tokens apart.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:char(36);index;not null" json:"-"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"`
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes     []string   `gorm:"type:json;serializer:json" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// issuer, identified by the issuer's subject.
+type UserIdentity struct {
+	ID        uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:char(36);index;not null" json:"-"`
+	Provider  string    `gorm:"size:50;not null" json:"provider"`
+	Issuer    string    `gorm:"size:255;uniqueIndex:idx_identity_subject;not null" json:"issuer"`
+	Subject   string    `gorm:"size:255;uniqueIndex:idx_identity_subject;not null" json:"subject"`
+	Email     string    `gorm:"size:255" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCLogin is an external login in progress, keyed by the hash of its
+// state parameter. It holds the nonce and PKCE verifier until the issuer
+// redirects back, and the device the login is for.
+type OIDCLogin struct {
+	StateHash    string    `gorm:"size:64;primaryKey" json:"-"`
+	Provider     string    `gorm:"size:50;not null" json:"-"`
+	Nonce        string    `gorm:"size:64;not null" json:"-"`
+	CodeVerifier string    `gorm:"size:128;not null" json:"-"`
+	Device       string    `gorm:"type:text" json:"-"`
+	ExpiresAt    time.Time `gorm:"index;not null" json:"-"`
+	CreatedAt    time.Time `json:"-"`
+}
+
+// LoginAttempt counts recent failed logins for one account or client IP,
+// keyed by "account:<email>" or "ip:<address>".
+type LoginAttempt struct {
+	Key          string     `gorm:"column:attempt_key;size:191;primaryKey" json:"-"`
+	Failures     int        `gorm:"not null;default:0" json:"-"`
+	LastFailure  *time.Time `json:"-"`
+	BlockedUntil *time.Time `json:"-"`
+	Locked       bool       `gorm:"not null;default:false" json:"-"`
+	ExpiresAt    time.Time  `gorm:"index;not null" json:"-"`
+}
+
+// AuditLog records a security-relevant event, such as an account lockout.
+// UserID is nil when the event is not tied to a known user.
+type AuditLog struct {
+	ID        uuid.UUID              `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    *uuid.UUID             `gorm:"type:char(36);index" json:"user_id"`
+	Event     string                 `gorm:"size:50;index;not null" json:"event"`
+	IP        string                 `gorm:"size:45" json:"ip"`
+	Detail    map[string]interface{} `gorm:"type:json;serializer:json" json:"detail"`
+	CreatedAt time.Time              `gorm:"index" json:"created_at"`
 }
@@ -0,0 +1,173 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/oidc/oidctest"
+)
+
+var (
+	keyOnce sync.Once
+	testKey *rsa.PrivateKey
+)
+
+// newIssuer starts a mock issuer, with handler wrapping it if given, and
+// returns it with a provider configured for it.
+func newIssuer(t *testing.T, wrap func(http.Handler) http.Handler) (*oidctest.Issuer, *Provider) {
+	t.Helper()
+	keyOnce.Do(func() {
+		var err error
+		if testKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	})
+	iss := oidctest.NewIssuer("", testKey)
+	var h http.Handler = iss
+	if wrap != nil {
+		h = wrap(iss)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	iss.URL = srv.URL
+	reg := NewRegistry([]config.OIDCProvider{{
+		Name:        "mock",
+		Issuer:      srv.URL,
+		ClientID:    "notes",
+		RedirectURL: "http://app.test/callback",
+		Scopes:      []string{"openid", "email"},
+	}}, srv.Client())
+	p, _ := reg.Get("mock")
+	return iss, p
+}
+
+// authorize runs the browser's side of a login: it follows the provider's
+// authorization URL and returns the code and state the issuer redirects
+// back with.
+func authorize(t *testing.T, p *Provider, state, nonce, challenge string) (code, gotState string) {
+	t.Helper()
+	u, err := p.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize = %s, Location %q", res.Status, res.Header.Get("Location"))
+	}
+	if !strings.HasPrefix(loc.String(), "http://app.test/callback?") {
+		t.Fatalf("redirected to %s, want the configured redirect URL", loc)
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestCodeFlowWithPKCE(t *testing.T) {
+	iss, p := newIssuer(t, nil)
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		code, state := authorize(t, p, "state-1", "nonce-1", challenge)
+		if state != "state-1" {
+			t.Errorf("state = %q, want it echoed back", state)
+		}
+		claims, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Claims{Issuer: iss.URL, Subject: "mock|dev@example.com", Email: "dev@example.com", EmailVerified: true, Name: "Dev User"}
+		if claims != want {
+			t.Errorf("claims = %+v, want %+v", claims, want)
+		}
+		if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); err == nil {
+			t.Error("a code was accepted twice")
+		}
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		code, _ := authorize(t, p, "state-2", "nonce-2", challenge)
+		other, _, _ := NewPKCE()
+		if _, err := p.Exchange(context.Background(), code, other, "nonce-2"); err == nil {
+			t.Error("exchange succeeded with another login's code verifier")
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		code, _ := authorize(t, p, "state-3", "nonce-3", challenge)
+		if _, err := p.Exchange(context.Background(), code, verifier, "another-nonce"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Exchange() error = %v, want ErrInvalidToken", err)
+		}
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		iss.Verified = false
+		defer func() { iss.Verified = true }()
+		code, _ := authorize(t, p, "state-4", "nonce-4", challenge)
+		claims, err := p.Exchange(context.Background(), code, verifier, "nonce-4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.EmailVerified {
+			t.Error("email_verified false was read as verified")
+		}
+	})
+}
+
+// TestSlowIssuerDoesNotBlockCachedLogins checks that a login waiting on the
+// issuer's key set does not hold up another that only needs the cached
+// discovery document.
+func TestSlowIssuerDoesNotBlockCachedLogins(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	_, p := newIssuer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/jwks" {
+				<-release
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	verifier, challenge, _ := NewPKCE()
+	code, _ := authorize(t, p, "state", "nonce", challenge)
+
+	go func() { _, _ = p.Exchange(context.Background(), code, verifier, "nonce") }()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.AuthCodeURL(context.Background(), "state-2", "nonce-2", challenge)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("AuthCodeURL waited for another login's key set fetch")
+	}
+}
+
+func TestDefaultClientHasTimeout(t *testing.T) {
+	p, _ := NewRegistry([]config.OIDCProvider{{Name: "x"}}, nil).Get("x")
+	if p.client.Timeout <= 0 {
+		t.Error("default issuer client has no timeout")
+	}
+}
@@ -0,0 +1,77 @@
+package password
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/your-org/notes-api/internal/config"
+)
+
+// bcryptMaxBytes is the longest input bcrypt accepts.
+const bcryptMaxBytes = 72
+
+var (
+	ErrTooShort = errors.New("password is too short")
+	ErrTooLong  = errors.New("password is too long")
+	// ErrBreached means the password is on the list of known breached
+	// passwords.
+	ErrBreached = errors.New("password has appeared in a data breach")
+)
+
+// Policy decides which new passwords are acceptable. It applies when a
+// password is set, never at login, so existing passwords keep working when
+// the policy is tightened.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	maxBytes  int
+	breached  map[string]struct{}
+}
+
+// LoadPolicy builds the policy from config, reading the breached password
+// list from PASSWORD_BREACHED_LIST if set: a text file with one password per
+// line, compared case-insensitively.
+func LoadPolicy(cfg config.Config) (*Policy, error) {
+	p := &Policy{MinLength: cfg.PasswordMinLength, MaxLength: cfg.PasswordMaxLength}
+	if cfg.PasswordHash == Bcrypt {
+		p.maxBytes = bcryptMaxBytes
+	}
+	if cfg.PasswordBreachedList == "" {
+		return p, nil
+	}
+	f, err := os.Open(cfg.PasswordBreachedList)
+	if err != nil {
+		return nil, fmt.Errorf("password: breached list: %w", err)
+	}
+	defer f.Close()
+	p.breached = map[string]struct{}{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			p.breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("password: breached list: %w", err)
+	}
+	return p, nil
+}
+
+// Check returns ErrTooShort, ErrTooLong or ErrBreached if the password may
+// not be used. Length is counted in characters; the bcrypt cap is in bytes.
+func (p *Policy) Check(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return ErrTooShort
+	}
+	if (p.MaxLength > 0 && utf8.RuneCountInString(password) > p.MaxLength) || (p.maxBytes > 0 && len(password) > p.maxBytes) {
+		return ErrTooLong
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return ErrBreached
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// sameJSON reports whether a and b hold the same JSON value.
+func sameJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// TestJSONPatch covers the examples of RFC 6902 Appendix A, then the array
+// index edge cases. A want of "" means the patch must fail.
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "A.8 testing a value: success",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:  "A.9 testing a value: error",
+			doc:   `{"baz":"qux"}`,
+			patch: `[{"op":"test","path":"/baz","value":"bar"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			want:  `{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			want:  `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+		},
+		{
+			name:  "A.13 invalid JSON Patch document",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux","op":"remove"}]`,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10}]`,
+			want:  `{"/":9,"~1":10}`,
+		},
+		{
+			name:  "A.15 comparing strings and numbers",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":"10"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:  "add at the end index",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `[{"op":"add","path":"/tags/2","value":"c"}]`,
+			want:  `{"tags":["a","b","c"]}`,
+		},
+		{
+			name:  "add past the end",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `[{"op":"add","path":"/tags/3","value":"c"}]`,
+		},
+		{
+			name:  "add with a leading zero index",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `[{"op":"add","path":"/tags/01","value":"c"}]`,
+		},
+		{
+			name:  "add with a negative index",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `[{"op":"add","path":"/tags/-1","value":"c"}]`,
+		},
+		{
+			name:  "add to an empty array with -",
+			doc:   `{"tags":[]}`,
+			patch: `[{"op":"add","path":"/tags/-","value":"a"}]`,
+			want:  `{"tags":["a"]}`,
+		},
+		{
+			name:  "remove the last element",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `[{"op":"remove","path":"/tags/1"}]`,
+			want:  `{"tags":["a"]}`,
+		},
+		{
+			name:  "remove past the end",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `[{"op":"remove","path":"/tags/2"}]`,
+		},
+		{
+			name:  "remove with -",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `[{"op":"remove","path":"/tags/-"}]`,
+		},
+		{
+			name:  "test guards a removal by index",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `[{"op":"test","path":"/tags/0","value":"b"},{"op":"remove","path":"/tags/0"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "test on a missing path",
+			doc:   `{"tags":["a"]}`,
+			patch: `[{"op":"test","path":"/tags/1","value":"a"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "failure leaves nothing applied",
+			doc:   `{"title":"a"}`,
+			patch: `[{"op":"replace","path":"/title","value":"b"},{"op":"remove","path":"/missing"}]`,
+		},
+		{
+			name:  "copy",
+			doc:   `{"a":{"x":1}}`,
+			patch: `[{"op":"copy","from":"/a","path":"/b"},{"op":"replace","path":"/b/x","value":2}]`,
+			want:  `{"a":{"x":1},"b":{"x":2}}`,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"","value":{"b":2}}]`,
+			want:  `{"b":2}`,
+		},
+		{
+			name:  "replace with null",
+			doc:   `{"title":"a","category":"work"}`,
+			patch: `[{"op":"replace","path":"/category","value":null}]`,
+			want:  `{"title":"a","category":null}`,
+		},
+		{
+			name:  "add null",
+			doc:   `{"title":"a"}`,
+			patch: `[{"op":"add","path":"/category","value":null}]`,
+			want:  `{"title":"a","category":null}`,
+		},
+		{
+			name:  "test against null",
+			doc:   `{"category":null}`,
+			patch: `[{"op":"test","path":"/category","value":null}]`,
+			want:  `{"category":null}`,
+		},
+		{
+			name:  "test null against a value",
+			doc:   `{"category":"work"}`,
+			patch: `[{"op":"test","path":"/category","value":null}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "test numbers by value",
+			doc:   `{"n":1,"list":[1.0,{"x":100}]}`,
+			patch: `[{"op":"test","path":"/n","value":1.0},{"op":"test","path":"/n","value":1e0},{"op":"test","path":"/list","value":[1,{"x":1e2}]}]`,
+			want:  `{"n":1,"list":[1.0,{"x":100}]}`,
+		},
+		{
+			name:  "test different numbers",
+			doc:   `{"n":1}`,
+			patch: `[{"op":"test","path":"/n","value":1.000001}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "test object member order",
+			doc:   `{"o":{"a":1,"b":2}}`,
+			patch: `[{"op":"test","path":"/o","value":{"b":2,"a":1}}]`,
+			want:  `{"o":{"a":1,"b":2}}`,
+		},
+		{
+			name:  "test object with an extra member",
+			doc:   `{"o":{"a":1}}`,
+			patch: `[{"op":"test","path":"/o","value":{"a":1,"b":null}}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "missing value",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"add","path":"/b"}]`,
+		},
+		{
+			name:  "unknown op",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"increment","path":"/a"}]`,
+		},
+		{
+			name:  "path without a leading slash",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"remove","path":"a"}]`,
+		},
+		{
+			name:  "not a list of operations",
+			doc:   `{"a":1}`,
+			patch: `{"op":"remove","path":"/a"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("JSONPatch() = %s, want an error", got)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Fatalf("JSONPatch() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("JSONPatch() error = %v", err)
+			}
+			if !sameJSON(t, got, []byte(tt.want)) {
+				t.Errorf("JSONPatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMerge covers the examples of RFC 7396 Appendix A.
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("Merge(%s, %s) error = %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if !sameJSON(t, got, []byte(tt.want)) {
+			t.Errorf("Merge(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := []byte(`{"title":"a","tags":["x"]}`)
+	tests := []struct {
+		contentType string
+		body        string
+		want        string
+		err         error
+	}{
+		{MergePatchType, `{"title":"b"}`, `{"title":"b","tags":["x"]}`, nil},
+		{"application/json", `{"tags":null}`, `{"title":"a"}`, nil},
+		{JSONPatchType, `[{"op":"add","path":"/tags/-","value":"y"}]`, `{"title":"a","tags":["x","y"]}`, nil},
+		{"text/plain", `{"title":"b"}`, "", ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		got, err := Apply(tt.contentType, doc, []byte(tt.body))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Apply(%s) error = %v, want %v", tt.contentType, err, tt.err)
+			continue
+		}
+		if tt.err == nil && !sameJSON(t, got, []byte(tt.want)) {
+			t.Errorf("Apply(%s) = %s, want %s", tt.contentType, got, tt.want)
+		}
+	}
+}
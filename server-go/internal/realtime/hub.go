@@ -0,0 +1,80 @@
+// Package realtime fans change log entries out to the streams of a user's
+// connected devices.
+package realtime
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// subscriptionBuffer is how many changes may queue up for a slow stream.
+// Changes that do not fit are dropped; streams recover them from the change
+// log, so a drop only delays delivery.
+const subscriptionBuffer = 64
+
+// Hub delivers changes to subscribers within this process. Streams also poll
+// the change log periodically, which covers changes committed by other
+// instances.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[uuid.UUID]map[*Subscription]struct{}{}}
+}
+
+// Subscription receives the changes published for one user.
+type Subscription struct {
+	C <-chan models.Change
+
+	c      chan models.Change
+	hub    *Hub
+	userID uuid.UUID
+}
+
+func (h *Hub) Subscribe(userID uuid.UUID) *Subscription {
+	ch := make(chan models.Change, subscriptionBuffer)
+	s := &Subscription{C: ch, c: ch, hub: h, userID: userID}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*Subscription]struct{}{}
+	}
+	h.subs[userID][s] = struct{}{}
+	return s
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s.userID][s]; !ok {
+		return
+	}
+	delete(h.subs[s.userID], s)
+	if len(h.subs[s.userID]) == 0 {
+		delete(h.subs, s.userID)
+	}
+	close(s.c)
+}
+
+// Publish delivers committed changes to their users' subscribers. It never
+// blocks; call it only after the transaction that recorded the changes has
+// committed.
+func (h *Hub) Publish(changes ...models.Change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range changes {
+		for s := range h.subs[ch.UserID] {
+			select {
+			case s.c <- ch:
+			default:
+			}
+		}
+	}
+}
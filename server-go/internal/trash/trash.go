@@ -0,0 +1,182 @@
+// Package trash permanently removes soft-deleted notes, either on request or
+// once they have been in the trash longer than TRASH_RETENTION. Its
+// background job also prunes revisions older than NOTE_REVISIONS_MAX_AGE.
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/your-org/notes-api/internal/changelog"
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/models"
+)
+
+// purgeBatch is how many expired notes, or revisions, one purge pass removes
+// at a time.
+const purgeBatch = 200
+
+// Purge hard-deletes the user's trashed notes with the given IDs, together
+// with their revisions and attachments. Notes that are not in the trash are
+// left alone. The note tombstones were logged when the notes were trashed;
+// attachment deletes are logged here. It returns the attachment files to
+// remove once tx commits, and the changes to publish.
+func Purge(tx *gorm.DB, userID uuid.UUID, noteIDs []uuid.UUID) ([]string, []models.Change, error) {
+	var ids []uuid.UUID
+	err := tx.Unscoped().Model(&models.Note{}).
+		Where("user_id = ? AND id IN ? AND deleted_at IS NOT NULL", userID, noteIDs).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, nil, err
+	}
+	var attachments []models.Attachment
+	if err := tx.Where("user_id = ? AND note_id IN ?", userID, ids).Find(&attachments).Error; err != nil {
+		return nil, nil, err
+	}
+	var files []string
+	var changes []models.Change
+	for _, a := range attachments {
+		if err := tx.Delete(&a).Error; err != nil {
+			return nil, nil, err
+		}
+		change, err := changelog.Record(tx, userID, changelog.EntityAttachment, a.ID, changelog.OpDelete)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, a.StoragePath)
+		changes = append(changes, change)
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&models.NoteRevision{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Note{}).Error; err != nil {
+		return nil, nil, err
+	}
+	return files, changes, nil
+}
+
+// RemoveFiles deletes attachment files after the rows describing them are
+// gone. Files that cannot be removed are unreachable and are not retried.
+func RemoveFiles(paths []string) {
+	for _, p := range paths {
+		_ = os.Remove(p)
+	}
+}
+
+// Purger empties notes out of the trash once their retention has passed,
+// and drops revisions that have outlived theirs.
+type Purger struct {
+	db             *gorm.DB
+	retention      time.Duration
+	revisionMaxAge time.Duration
+	interval       time.Duration
+}
+
+func NewPurger(cfg config.Config, db *gorm.DB) *Purger {
+	return &Purger{db: db, retention: cfg.TrashRetention, revisionMaxAge: cfg.NoteRevisionsMaxAge, interval: cfg.TrashPurgeInterval}
+}
+
+// Run purges expired notes and revisions every interval until ctx is done.
+// A retention of 0 keeps trashed notes until the user removes them, and a
+// revision max age of 0 keeps revisions until the per-note limit drops them.
+func (p *Purger) Run(ctx context.Context) {
+	if p.interval <= 0 || (p.retention <= 0 && p.revisionMaxAge <= 0) {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if p.retention > 0 {
+			if err := p.PurgeExpired(ctx); err != nil {
+				log.Printf("trash purge: %v", err)
+			}
+		}
+		if p.revisionMaxAge > 0 {
+			if err := p.PruneRevisions(ctx); err != nil {
+				log.Printf("revision prune: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired removes every note trashed more than retention ago. Clients
+// pick up the attachment deletes from the change log; nothing is published.
+// A user whose notes cannot be purged is logged and skipped until the next
+// run, so one bad row does not hold back everyone else's; the errors are
+// returned together at the end.
+func (p *Purger) PurgeExpired(ctx context.Context) error {
+	cutoff := time.Now().Add(-p.retention)
+	var errs []error
+	failed := map[uuid.UUID]bool{}
+	for ctx.Err() == nil {
+		var expired []models.Note
+		q := p.db.Unscoped().Select("id", "user_id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
+		if len(failed) > 0 {
+			q = q.Where("user_id NOT IN ?", keys(failed))
+		}
+		err := q.Order("deleted_at asc").Limit(purgeBatch).Find(&expired).Error
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		byUser := map[uuid.UUID][]uuid.UUID{}
+		for _, n := range expired {
+			byUser[n.UserID] = append(byUser[n.UserID], n.ID)
+		}
+		for uid, ids := range byUser {
+			var files []string
+			err := p.db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				files, _, err = Purge(tx, uid, ids)
+				return err
+			})
+			if err != nil {
+				log.Printf("trash purge: user %s: %v", uid, err)
+				errs = append(errs, fmt.Errorf("user %s: %w", uid, err))
+				failed[uid] = true
+				continue
+			}
+			RemoveFiles(files)
+		}
+		if len(expired) < purgeBatch {
+			return errors.Join(errs...)
+		}
+	}
+	return errors.Join(append(errs, ctx.Err())...)
+}
+
+func keys(m map[uuid.UUID]bool) []uuid.UUID {
+	out := make([]uuid.UUID, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+// PruneRevisions deletes revisions older than the revision max age. Writes
+// already prune the revisions of the note they change; this catches notes
+// that are no longer being written. A note's current revision is kept.
+func (p *Purger) PruneRevisions(ctx context.Context) error {
+	cutoff := time.Now().Add(-p.revisionMaxAge)
+	for ctx.Err() == nil {
+		res := p.db.Exec(`DELETE FROM note_revisions WHERE created_at < ?
+			AND version < (SELECT n.version FROM notes n WHERE n.id = note_revisions.note_id)
+			LIMIT ?`, cutoff, purgeBatch)
+		if res.Error != nil || res.RowsAffected < purgeBatch {
+			return res.Error
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,144 @@
+package trash
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/your-org/notes-api/internal/config"
+	"github.com/your-org/notes-api/internal/dbtest"
+)
+
+// TestPurgeExpiredSkipsFailingUser checks that a user whose notes cannot be
+// purged does not hold back anyone else's, in the failing batch or in the
+// ones after it, and that the failure is still reported.
+func TestPurgeExpiredSkipsFailingUser(t *testing.T) {
+	good, bad, later := uuid.New(), uuid.New(), uuid.New()
+	notes := map[uuid.UUID][]uuid.UUID{good: {uuid.New()}, later: {uuid.New()}}
+	for i := 0; i < purgeBatch-1; i++ {
+		notes[bad] = append(notes[bad], uuid.New())
+	}
+	owner := map[string]uuid.UUID{}
+	for uid, ids := range notes {
+		for _, id := range ids {
+			owner[id.String()] = uid
+		}
+	}
+	rowsOf := func(users ...uuid.UUID) [][]driver.Value {
+		var rows [][]driver.Value
+		for _, uid := range users {
+			for _, id := range notes[uid] {
+				rows = append(rows, []driver.Value{id.String(), uid.String()})
+			}
+		}
+		return rows
+	}
+
+	lists := 0
+	purged := map[uuid.UUID]int{}
+	db := dbtest.Open(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case dbtest.Match(query, "SELECT id,user_id FROM notes"):
+			lists++
+			switch {
+			case lists == 1:
+				// A full batch, so the purge comes back for more.
+				return dbtest.Result{Columns: []string{"id", "user_id"}, Rows: rowsOf(good, bad)}
+			case lists == 2 && strings.Contains(query, "user_id NOT IN") && args[1] == bad.String():
+				return dbtest.Result{Columns: []string{"id", "user_id"}, Rows: rowsOf(later)}
+			case lists > 3:
+				t.Fatal("purge did not stop listing")
+			}
+			return dbtest.Result{Columns: []string{"id", "user_id"}, Rows: rowsOf(bad)}
+		case dbtest.Match(query, "SELECT id FROM notes"):
+			if args[0] == bad.String() {
+				return dbtest.Result{Err: errors.New("deadlock found")}
+			}
+			var rows [][]driver.Value
+			for _, a := range args[1:] {
+				if id, ok := a.(string); ok && owner[id].String() == args[0] {
+					rows = append(rows, []driver.Value{id})
+				}
+			}
+			return dbtest.Result{Columns: []string{"id"}, Rows: rows}
+		case dbtest.Match(query, "DELETE FROM notes"):
+			for _, a := range args {
+				if id, ok := a.(string); ok {
+					purged[owner[id]]++
+				}
+			}
+			return dbtest.Result{RowsAffected: int64(len(args))}
+		}
+		return dbtest.Result{}
+	})
+
+	p := NewPurger(config.Config{TrashRetention: time.Hour}, db)
+	err := p.PurgeExpired(context.Background())
+	if err == nil || !strings.Contains(err.Error(), bad.String()) {
+		t.Errorf("PurgeExpired() error = %v, want the failing user's error", err)
+	}
+	if purged[good] != 1 || purged[later] != 1 {
+		t.Errorf("purged %d and %d notes of the other users, want 1 and 1", purged[good], purged[later])
+	}
+	if purged[bad] != 0 {
+		t.Errorf("purged %d notes of the failing user", purged[bad])
+	}
+}
+
+// TestRunPurgesUntilCancelled checks that the background job purges on
+// every tick and stops when its context is done.
+func TestRunPurgesUntilCancelled(t *testing.T) {
+	runs := make(chan struct{}, 1)
+	db := dbtest.Open(t, func(query string, _ []driver.Value) dbtest.Result {
+		if dbtest.Match(query, "SELECT id,user_id FROM notes") {
+			select {
+			case runs <- struct{}{}:
+			default:
+			}
+		}
+		return dbtest.Result{}
+	})
+	p := NewPurger(config.Config{TrashRetention: time.Hour, TrashPurgeInterval: time.Millisecond}, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("purge ran %d times, want it to run again on the next tick", i)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+}
+
+func TestRunDisabled(t *testing.T) {
+	db := dbtest.Open(t, func(query string, _ []driver.Value) dbtest.Result {
+		t.Errorf("disabled purger ran %s", query)
+		return dbtest.Result{}
+	})
+	done := make(chan struct{})
+	go func() {
+		NewPurger(config.Config{TrashPurgeInterval: time.Millisecond}, db).Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return with retention and revision max age both 0")
+	}
+}